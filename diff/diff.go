@@ -52,6 +52,20 @@ func (d *Diff) ExcludeRegexp(regexps ...string) *Diff {
 	}
 }
 
+// Paths returns the paths, in Go-Patch style (e.g. "/spec/replicas"), of the
+// fields that are different between the compared documents.
+func (d *Diff) Paths() []string {
+	res := make([]string, 0, len(d.Diffs))
+	for _, dd := range d.Diffs {
+		if dd.Path == nil {
+			res = append(res, "/")
+			continue
+		}
+		res = append(res, dd.Path.ToGoPatchStyle())
+	}
+	return res
+}
+
 // String returns a formatted string containing the diff of the compared
 // documents.
 func (d *Diff) String() string {
@@ -100,7 +114,7 @@ func New[T Diffable](
 		}
 		af = ytbx.InputFile{Documents: adoc}
 	case *unstructured.Unstructured:
-		abytes, err := yaml.Marshal(a)
+		abytes, err := yaml.Marshal(a.Object)
 		if err != nil {
 			return nil, fmt.Errorf(
 				"failed to marshal resource A: %w",
@@ -127,7 +141,7 @@ func New[T Diffable](
 		}
 		bf = ytbx.InputFile{Documents: bdoc}
 	case *unstructured.Unstructured:
-		bbytes, err := yaml.Marshal(b)
+		bbytes, err := yaml.Marshal(b.Object)
 		if err != nil {
 			return nil, fmt.Errorf(
 				"failed to marshal resource A: %w",
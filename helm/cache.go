@@ -0,0 +1,372 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jaypipes/kube-inspect/debug"
+)
+
+const (
+	// DefaultCacheTTL is the length of time that entries in the chart cache
+	// are considered fresh if WithCacheTTL() or ChartVersionsWithCacheTTL() is
+	// not supplied.
+	DefaultCacheTTL = 24 * time.Hour
+)
+
+// WithCacheDir enables an on-disk cache, in the supplied directory, of the
+// Helm Chart archives that are downloaded when the subject of Inspect() is an
+// HTTP(S) or OCI registry URL or when resolving dependencies, and of the Helm
+// repository index files that are downloaded when resolving dependencies.
+// Entries are considered fresh for DefaultCacheTTL unless WithCacheTTL() is
+// supplied.
+//
+// The same directory may be passed to ChartVersionsWithCacheDir() to share
+// cached Helm repository index files.
+func WithCacheDir(dir string) InspectOption {
+	return func(opts *InspectOptions) {
+		opts.cacheDir = dir
+	}
+}
+
+// WithCacheTTL sets the length of time that entries in the chart cache (see
+// WithCacheDir()) are considered fresh. Expired entries are fetched again and
+// evicted from the cache. A zero or negative TTL means that entries never
+// expire.
+func WithCacheTTL(ttl time.Duration) InspectOption {
+	return func(opts *InspectOptions) {
+		opts.cacheTTL = ttl
+	}
+}
+
+// ChartVersionsWithCacheDir returns a ChartVersionsOption that enables an
+// on-disk cache, in the supplied directory, of downloaded Helm repository
+// index files. See WithCacheDir().
+func ChartVersionsWithCacheDir(dir string) ChartVersionsOption {
+	return func(o *ChartVersionsOptions) {
+		o.cacheDir = dir
+	}
+}
+
+// ChartVersionsWithCacheTTL returns a ChartVersionsOption that sets the length
+// of time that cached Helm repository index files are considered fresh. See
+// WithCacheTTL().
+func ChartVersionsWithCacheTTL(ttl time.Duration) ChartVersionsOption {
+	return func(o *ChartVersionsOptions) {
+		o.cacheTTL = ttl
+	}
+}
+
+// chartCache is an on-disk, content-addressed cache of Helm Chart archives
+// and Helm repository index files.
+//
+// Content is stored in blobs/sha256/<hex digest of content>. References to
+// content are stored in refs/<hex digest of key>, where the key is the URL,
+// version and (if known) digest of the cached content, and contain the hex
+// digest of the referenced content. The modification time of a reference is
+// the time the content was cached and is used to determine expiry.
+//
+// Expired references and unreferenced content are evicted at most once per
+// TTL, recorded by the modification time of the last-evicted file. Content is
+// only evicted once it has been unreferenced for longer than the TTL, so that
+// content cached concurrently, whose reference may not have been written yet,
+// is never evicted.
+type chartCache struct {
+	dir string
+	ttl time.Duration
+	// offline indicates that content that is not in the cache must not be
+	// fetched.
+	offline bool
+}
+
+// newChartCache returns a chartCache using the supplied directory and TTL, or
+// nil if the supplied directory is empty.
+func newChartCache(dir string, ttl time.Duration) *chartCache {
+	if dir == "" {
+		return nil
+	}
+	return &chartCache{dir: dir, ttl: ttl}
+}
+
+// chartCache returns the chartCache enabled with WithCacheDir(), or nil if the
+// chart cache is not enabled. If WithOffline() was supplied, cached entries
+// never expire.
+func (o *InspectOptions) chartCache() *chartCache {
+	c := newChartCache(o.cacheDir, o.cacheTTL)
+	if c != nil && o.offline {
+		c.ttl = 0
+		c.offline = true
+	}
+	return c
+}
+
+// checkOnline returns an error if content at the supplied URL, which is not in
+// the cache, must not be fetched because the cache is offline. Safe to call on
+// a nil chartCache.
+func (c *chartCache) checkOnline(url string) error {
+	if c == nil || !c.offline {
+		return nil
+	}
+	return fmt.Errorf("%s not found in chart cache", url)
+}
+
+// cacheKey identifies an entry in the chartCache.
+type cacheKey struct {
+	// url is the URL the content was fetched from.
+	url string
+	// version is the chart version of the content, if any.
+	version string
+	// digest is the SHA-256 digest of the content, if known, either as a hex
+	// string or prefixed with "sha256:".
+	digest string
+}
+
+// refName returns the name of the reference file for the key.
+func (k cacheKey) refName() string {
+	h := sha256.Sum256([]byte(k.url + "\x00" + k.version + "\x00" + k.digest))
+	return hex.EncodeToString(h[:])
+}
+
+// contentDigest returns the key's content digest as a hex string, or an
+// empty string if the key has no SHA-256 digest.
+func (k cacheKey) contentDigest() string {
+	d := strings.TrimPrefix(k.digest, "sha256:")
+	if len(d) != sha256.Size*2 {
+		return ""
+	}
+	if _, err := hex.DecodeString(d); err != nil {
+		return ""
+	}
+	return strings.ToLower(d)
+}
+
+func (c *chartCache) refPath(key cacheKey) string {
+	return filepath.Join(c.dir, "refs", key.refName())
+}
+
+func (c *chartCache) blobPath(digest string) string {
+	return filepath.Join(c.dir, "blobs", "sha256", digest)
+}
+
+// expired returns true if content cached at the supplied time is no longer
+// fresh.
+func (c *chartCache) expired(cachedAt time.Time) bool {
+	return c.ttl > 0 && time.Since(cachedAt) > c.ttl
+}
+
+// get returns the path to the cached content for the supplied key, or false
+// if there is no fresh cached content for the key. Safe to call on a nil
+// chartCache.
+func (c *chartCache) get(ctx context.Context, key cacheKey) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	if digest := key.contentDigest(); digest != "" {
+		// The content is immutable, so if we have it we don't need to check
+		// expiry.
+		path := c.blobPath(digest)
+		if _, err := os.Stat(path); err == nil {
+			debug.Printf(ctx, "cache hit for %s (digest %s)\n", key.url, digest)
+			return path, true
+		}
+	}
+	refPath := c.refPath(key)
+	fi, err := os.Stat(refPath)
+	if err != nil {
+		return "", false
+	}
+	if c.expired(fi.ModTime()) {
+		debug.Printf(ctx, "cache entry for %s has expired\n", key.url)
+		return "", false
+	}
+	b, err := os.ReadFile(refPath)
+	if err != nil {
+		return "", false
+	}
+	path := c.blobPath(strings.TrimSpace(string(b)))
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	debug.Printf(ctx, "cache hit for %s\n", key.url)
+	return path, true
+}
+
+// put stores the content read from the supplied io.Reader in the cache under
+// the supplied key, evicts any expired entries if due and returns the path to
+// the cached content. Safe to call on a nil chartCache, in which case the
+// content is not read.
+func (c *chartCache) put(
+	ctx context.Context,
+	key cacheKey,
+	r io.Reader,
+) (string, error) {
+	if c == nil {
+		return "", nil
+	}
+	blobDir := filepath.Join(c.dir, "blobs", "sha256")
+	refDir := filepath.Join(c.dir, "refs")
+	for _, dir := range []string{blobDir, refDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", fmt.Errorf("failed to create cache dir: %w", err)
+		}
+	}
+	tf, err := os.CreateTemp(blobDir, ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tf.Name())
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tf, h), r)
+	if cerr := tf.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	if want := key.contentDigest(); want != "" && want != digest {
+		return "", fmt.Errorf(
+			"digest mismatch for %s: expected %s but got %s",
+			key.url, want, digest,
+		)
+	}
+	path := c.blobPath(digest)
+	if err := os.Rename(tf.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := writeFileAtomic(c.refPath(key), []byte(digest)); err != nil {
+		return "", fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	debug.Printf(ctx, "cached %s as %s\n", key.url, digest)
+	if !c.evictionDue() {
+		return path, nil
+	}
+	if err := c.evict(ctx); err != nil {
+		debug.Printf(ctx, "failed to evict expired cache entries: %s\n", err)
+	}
+	return path, nil
+}
+
+// evictionDue returns true if expired cache entries have not been evicted
+// within the TTL, and records that they are about to be.
+func (c *chartCache) evictionDue() bool {
+	if c.ttl <= 0 {
+		return false
+	}
+	path := filepath.Join(c.dir, "last-evicted")
+	if fi, err := os.Stat(path); err == nil && !c.expired(fi.ModTime()) {
+		return false
+	}
+	return writeFileAtomic(path, nil) == nil
+}
+
+// evict removes expired references from the cache along with any content
+// that is no longer referenced and was cached longer than the TTL ago.
+func (c *chartCache) evict(ctx context.Context) error {
+	refDir := filepath.Join(c.dir, "refs")
+	entries, err := os.ReadDir(refDir)
+	if err != nil {
+		return err
+	}
+	referenced := map[string]bool{}
+	for _, entry := range entries {
+		path := filepath.Join(refDir, entry.Name())
+		fi, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if c.expired(fi.ModTime()) {
+			debug.Printf(ctx, "evicting expired cache entry %s\n", entry.Name())
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			continue
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		referenced[strings.TrimSpace(string(b))] = true
+	}
+	blobDir := filepath.Join(c.dir, "blobs", "sha256")
+	blobs, err := os.ReadDir(blobDir)
+	if err != nil {
+		return err
+	}
+	for _, blob := range blobs {
+		name := blob.Name()
+		if referenced[name] || strings.HasPrefix(name, ".tmp-") {
+			continue
+		}
+		// Content cached within the TTL may belong to a concurrent put
+		// whose reference was written after the references were read.
+		fi, err := blob.Info()
+		if err != nil || !c.expired(fi.ModTime()) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(blobDir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchCached returns the content at the supplied URL, using the supplied
+// chart cache (which may be nil) if enabled.
+func fetchCached(
+	ctx context.Context,
+	url string,
+	httpOpts *httpOptions,
+	cache *chartCache,
+) ([]byte, error) {
+	key := cacheKey{url: url}
+	if path, ok := cache.get(ctx, key); ok {
+		return os.ReadFile(path)
+	}
+	if err := cache.checkOnline(url); err != nil {
+		return nil, err
+	}
+	resp, err := httpOpts.get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := cache.put(ctx, key, bytes.NewReader(b)); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// writeFileAtomic writes the supplied data to a temporary file and renames it
+// to the supplied path so that readers never see a partially-written file.
+func writeFileAtomic(path string, data []byte) error {
+	tf, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tf.Name())
+	_, err = tf.Write(data)
+	if cerr := tf.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tf.Name(), path)
+}
@@ -0,0 +1,180 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	kihelm "github.com/jaypipes/kube-inspect/helm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// requestCounter counts the requests made for each path.
+type requestCounter struct {
+	sync.Mutex
+	counts map[string]int
+}
+
+func (c *requestCounter) get(path string) int {
+	c.Lock()
+	defer c.Unlock()
+	return c.counts[path]
+}
+
+// serveCountingHelmRepository starts an HTTP server serving a Helm repository
+// that contains the supplied versions of a "child" chart and counts the
+// requests made for each path.
+func serveCountingHelmRepository(
+	t *testing.T,
+	versions ...string,
+) (*httptest.Server, *requestCounter) {
+	repoDir := writeHelmRepository(t, versions...)
+	fs := http.FileServer(http.Dir(repoDir))
+	counter := &requestCounter{counts: map[string]int{}}
+	srv := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			counter.Lock()
+			counter.counts[r.URL.Path]++
+			counter.Unlock()
+			fs.ServeHTTP(w, r)
+		}),
+	)
+	t.Cleanup(srv.Close)
+	return srv, counter
+}
+
+func TestInspectWithCacheDir(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	srv, counter := serveCountingHelmRepository(t, "0.1.0")
+	cacheDir := t.TempDir()
+	archiveURL := srv.URL + "/child-0.1.0.tgz"
+
+	for x := 0; x < 3; x++ {
+		c, err := kihelm.Inspect(ctx, archiveURL, kihelm.WithCacheDir(cacheDir))
+		require.Nil(err)
+		assert.Equal("child", c.Name())
+	}
+	assert.Equal(1, counter.get("/child-0.1.0.tgz"))
+
+	// Without the cache, the archive is downloaded every time
+	_, err := kihelm.Inspect(ctx, archiveURL)
+	require.Nil(err)
+	assert.Equal(2, counter.get("/child-0.1.0.tgz"))
+}
+
+func TestInspectWithCacheTTL(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	srv, counter := serveCountingHelmRepository(t, "0.1.0")
+	cacheDir := t.TempDir()
+	archiveURL := srv.URL + "/child-0.1.0.tgz"
+
+	_, err := kihelm.Inspect(
+		ctx, archiveURL,
+		kihelm.WithCacheDir(cacheDir),
+		kihelm.WithCacheTTL(50*time.Millisecond),
+	)
+	require.Nil(err)
+	time.Sleep(100 * time.Millisecond)
+
+	_, err = kihelm.Inspect(
+		ctx, archiveURL,
+		kihelm.WithCacheDir(cacheDir),
+		kihelm.WithCacheTTL(50*time.Millisecond),
+	)
+	require.Nil(err)
+	assert.Equal(2, counter.get("/child-0.1.0.tgz"))
+
+	// The expired entry was evicted when the archive was cached again, so
+	// only a single copy of the archive remains in the cache.
+	blobs, err := os.ReadDir(filepath.Join(cacheDir, "blobs", "sha256"))
+	require.Nil(err)
+	assert.Len(blobs, 1)
+	refs, err := os.ReadDir(filepath.Join(cacheDir, "refs"))
+	require.Nil(err)
+	assert.Len(refs, 1)
+}
+
+func TestChartVersionsFromLocationWithCacheDir(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	srv, counter := serveCountingHelmRepository(t, "0.1.0", "0.2.0")
+	cacheDir := t.TempDir()
+
+	loc, err := kihelm.ChartLocationFromURL(srv.URL + "/child")
+	require.Nil(err)
+	for x := 0; x < 3; x++ {
+		vers, err := kihelm.ChartVersionsFromLocation(
+			ctx, loc, kihelm.ChartVersionsWithCacheDir(cacheDir),
+		)
+		require.Nil(err)
+		require.Len(vers, 2)
+	}
+	assert.Equal(1, counter.get("/index.yaml"))
+
+	// Dependency resolution shares the cached index file
+	_, err = kihelm.Inspect(
+		ctx, umbrellaChart(srv.URL, "0.1.0"),
+		kihelm.WithDependencyResolution(),
+		kihelm.WithCacheDir(cacheDir),
+	)
+	require.Nil(err)
+	assert.Equal(1, counter.get("/index.yaml"))
+	assert.Equal(1, counter.get("/child-0.1.0.tgz"))
+}
+
+func TestInspectWithCacheTTLEviction(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	srv, _ := serveCountingHelmRepository(t, "0.1.0", "0.2.0", "0.3.0")
+	cacheDir := t.TempDir()
+	inspect := func(version string) {
+		_, err := kihelm.Inspect(
+			ctx, srv.URL+"/child-"+version+".tgz",
+			kihelm.WithCacheDir(cacheDir),
+			kihelm.WithCacheTTL(time.Hour),
+		)
+		require.Nil(err)
+	}
+	inspect("0.1.0")
+
+	// Unreferenced content cached longer than the TTL ago can be evicted,
+	// but recently cached content may not have its reference written yet.
+	blobDir := filepath.Join(cacheDir, "blobs", "sha256")
+	stale := filepath.Join(blobDir, strings.Repeat("a", 64))
+	fresh := filepath.Join(blobDir, strings.Repeat("b", 64))
+	longAgo := time.Now().Add(-2 * time.Hour)
+	for _, path := range []string{stale, fresh} {
+		require.Nil(os.WriteFile(path, []byte(path), 0o644))
+	}
+	require.Nil(os.Chtimes(stale, longAgo, longAgo))
+
+	// Eviction happens at most once per TTL
+	inspect("0.2.0")
+	assert.FileExists(stale)
+
+	lastEvicted := filepath.Join(cacheDir, "last-evicted")
+	require.Nil(os.Chtimes(lastEvicted, longAgo, longAgo))
+	inspect("0.3.0")
+	assert.NoFileExists(stale)
+	assert.FileExists(fresh)
+	blobs, err := os.ReadDir(blobDir)
+	require.Nil(err)
+	assert.Len(blobs, 4)
+}
@@ -8,12 +8,13 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"strings"
 
 	"github.com/Masterminds/semver/v3"
 	"helm.sh/helm/v3/pkg/action"
 	helmchart "helm.sh/helm/v3/pkg/chart"
 	helmchartutil "helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/strvals"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	"github.com/jaypipes/kube-inspect/debug"
@@ -31,6 +32,15 @@ type Chart struct {
 	// `unstructured.Unstructured` documents that was found in the
 	// rendered/synthesized Helm Chart.
 	resources []*unstructured.Unstructured
+	// hooks is the slice of Helm hooks that were rendered for the Helm Chart.
+	hooks []*release.Hook
+	// sources is a map, keyed by resource key (see `resourceKey()`), of the
+	// path of the template that rendered the resource.
+	sources map[string]string
+	// origin describes where the Helm Chart came from.
+	origin *Origin
+	// verification is the result of verifying the Helm Chart's provenance.
+	verification *Verification
 }
 
 // render installs the Helm chart and sets the Chart.manifest to a buffer
@@ -50,35 +60,105 @@ func (c *Chart) render(
 	ctx = debug.PushTrace(ctx, "helm:chart:render")
 	defer debug.PopTrace(ctx)
 
+	opts := c.inspectOpts
 	installer := action.NewInstall(&action.Configuration{})
 	installer.ClientOnly = true
 	installer.DryRun = true
-	installer.ReleaseName = "kube-inspect"
-	installer.IncludeCRDs = true
-	installer.Namespace = "default"
-	installer.DisableHooks = true
+	installer.ReleaseName = opts.releaseName
+	installer.IncludeCRDs = !opts.skipCRDs
+	installer.Namespace = opts.namespace
+	installer.DisableHooks = !opts.includeHooks
 
-	// The Helm Chart may specify a KubeVersion in its metadata that is
-	// incompatible with the Kubernetes client version used in compiling the
-	// Helm Go SDK. If this is the case, we need to pass an updated KubeVersion
-	// installer option when rendering.
-	if err := c.autoAdjustKubeVersion(ctx, installer); err != nil {
-		return err
+	if opts.kubeVersion != "" {
+		kv, err := helmchartutil.ParseKubeVersion(opts.kubeVersion)
+		if err != nil {
+			return fmt.Errorf(
+				"invalid kube version %q: %w", opts.kubeVersion, err,
+			)
+		}
+		debug.Printf(ctx, "using kube version: %s\n", kv.String())
+		installer.KubeVersion = kv
+	} else {
+		// The Helm Chart may specify a KubeVersion in its metadata that is
+		// incompatible with the Kubernetes client version used in compiling
+		// the Helm Go SDK. If this is the case, we need to pass an updated
+		// KubeVersion installer option when rendering.
+		if err := c.autoAdjustKubeVersion(ctx, installer); err != nil {
+			return err
+		}
+	}
+	if len(opts.apiVersions) > 0 {
+		debug.Printf(ctx, "using additional API versions: %v\n", opts.apiVersions)
+		installer.APIVersions = helmchartutil.VersionSet(opts.apiVersions)
 	}
 
-	opts := c.inspectOpts
 	if opts.values != nil {
 		debug.Printf(ctx, "using value overrides: %v\n", opts.values)
 	}
-	release, err := installer.Run(hc, opts.values)
+	// The Helm SDK removes disabled subcharts from the chart it installs, so
+	// we install a copy of the chart in order to be able to render the chart
+	// again with different values.
+	rel, err := installer.Run(copyChart(hc), opts.values)
 	if err != nil {
 		return err
 	}
-	c.manifest = bytes.NewBuffer([]byte(release.Manifest))
+	manifest := bytes.NewBuffer([]byte(rel.Manifest))
+	if opts.includeHooks {
+		// Just like `helm template`, we append the hook manifests to the
+		// rendered manifest when hooks are enabled.
+		for _, h := range rel.Hooks {
+			fmt.Fprintf(manifest, "---\n# Source: %s\n%s\n", h.Path, h.Manifest)
+		}
+	}
+	c.manifest = manifest
+	c.hooks = rel.Hooks
 	c.rendered = true
 	return nil
 }
 
+// copyChart returns a copy of the supplied helm sdk-go Chart and its
+// subcharts. The chart files and metadata are not copied.
+func copyChart(hc *helmchart.Chart) *helmchart.Chart {
+	cp := *hc
+	deps := make([]*helmchart.Chart, 0, len(hc.Dependencies()))
+	for _, d := range hc.Dependencies() {
+		deps = append(deps, copyChart(d))
+	}
+	cp.SetDependencies(deps...)
+	return &cp
+}
+
+// resourcesWithSetValue returns the Kubernetes resources that are rendered
+// when the supplied "strvals" value, e.g. "pdb.create=true", is set on top of
+// the values used to inspect the Helm Chart. The Chart itself is not
+// modified.
+func (c *Chart) resourcesWithSetValue(
+	ctx context.Context,
+	setValue string,
+) ([]*unstructured.Unstructured, error) {
+	vals := copyValues(c.inspectOpts.values)
+	if err := strvals.ParseInto(setValue, vals); err != nil {
+		return nil, fmt.Errorf("failed to parse values %q: %w", setValue, err)
+	}
+	return c.resourcesWithValues(ctx, vals)
+}
+
+// resourcesWithValues returns the Kubernetes resources that are rendered
+// when the supplied values are used in place of the values used to inspect
+// the Helm Chart. The Chart itself is not modified.
+func (c *Chart) resourcesWithValues(
+	ctx context.Context,
+	vals map[string]any,
+) ([]*unstructured.Unstructured, error) {
+	opts := *c.inspectOpts
+	opts.values = vals
+	other := &Chart{
+		Chart:       c.Chart,
+		inspectOpts: &opts,
+	}
+	return other.Resources(ctx)
+}
+
 // autoAdjustKubeVersion detects if the KubeVersion used by the Helm SDK is
 // incompatible with the required KubeVersion specified in the Helm Chart
 // metadata KubeVersion. If incompatible, the function figures out an
@@ -104,34 +184,14 @@ func (c *Chart) autoAdjustKubeVersion(
 		helmchartutil.DefaultCapabilities.KubeVersion.String(),
 	)
 	if !vc.Check(dv) {
-		var uv *semver.Version
-		constraintStr := strings.TrimSpace(vc.String())
-		if strings.HasPrefix(constraintStr, "<=") || strings.HasPrefix(constraintStr, ">=") {
-			wantVer := strings.TrimPrefix(
-				strings.TrimPrefix(
-					constraintStr, "<=",
-				), ">=",
-			)
-			uv, err = semver.NewVersion(wantVer)
-			if err != nil {
-				return err
-			}
-		} else if strings.HasPrefix(constraintStr, "<") {
-			wantVer := strings.TrimPrefix(constraintStr, "<")
-			ov, err := semver.NewVersion(wantVer)
-			if err != nil {
-				return err
-			}
-			uv = semver.New(ov.Major(), ov.Minor()-1, ov.Patch(), "", "")
-		} else if strings.HasPrefix(constraintStr, ">") {
-			wantVer := strings.TrimPrefix(constraintStr, ">")
-			ov, err := semver.NewVersion(wantVer)
-			if err != nil {
-				return err
-			}
-			uv = semver.New(ov.Major(), ov.Minor()+1, ov.Patch(), "", "")
+		uv, err := solveKubeVersion(hc.Metadata.KubeVersion, vc, dv)
+		if err != nil {
+			return err
+		}
+		newKV, err := helmchartutil.ParseKubeVersion(uv.String())
+		if err != nil {
+			return err
 		}
-		newKV, _ := helmchartutil.ParseKubeVersion(uv.String())
 		debug.Printf(
 			ctx,
 			"version check failed for default Helm SDK kubeVersion %q. "+
@@ -1,7 +1,11 @@
 package helm
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 
 	"helm.sh/helm/v3/pkg/cli"
@@ -9,14 +13,24 @@ import (
 	"helm.sh/helm/v3/pkg/registry"
 	"helm.sh/helm/v3/pkg/repo"
 	"oras.land/oras-go/v2/registry/remote"
-	"oras.land/oras-go/v2/registry/remote/auth"
-	"oras.land/oras-go/v2/registry/remote/credentials"
+
+	"github.com/jaypipes/kube-inspect/debug"
 )
 
 // ChartLocation describes where a HelmChart can be found.
 type ChartLocation struct {
-	// URL is the local filepath or OCI repository URL for the Helm Chart. If
-	// empty, the Repository and ChartName fields should be non-empty.
+	// URL is the local filepath, Git repository URL or OCI repository URL for
+	// the Helm Chart. If empty, the Repository and ChartName fields should be
+	// non-empty.
+	//
+	// A local filepath (prefixed with file://) may refer to an unpacked Helm
+	// Chart directory, a Helm Chart archive or a directory containing
+	// multiple Helm Chart archives.
+	//
+	// A Git repository URL is prefixed with git+ and may contain the path to
+	// the Helm Chart within the Git repository after a double slash and the
+	// Git ref (branch, tag or commit) to use in a ref query parameter, e.g.
+	// git+https://github.com/org/repo.git//charts/mychart?ref=v1.2.3.
 	URL string `json:"url,omitempty"`
 	// Repository is the Helm Chart repository URL for the Helm Chart. If empty,
 	// URL should be non-empty and contain the OCI repository URL for the Helm
@@ -24,8 +38,15 @@ type ChartLocation struct {
 	Repository string `json:"repository,omitempty"`
 	// Name is the name for the Helm Chart. If empty, URL should be non-empty
 	// and contain the OCI repository URL for the Helm Chart. If not empty,
-	// Repository should also be not empty.
+	// Repository should also be not empty, unless URL refers to a local
+	// directory containing Helm Chart archives of multiple Helm Charts, in
+	// which case Name selects the Helm Chart.
 	Name string `json:"name,omitempty"`
+	// repoEntry is the helm CLI's repository configuration for the Helm
+	// repository, if the ChartLocation was resolved from a repository name
+	// by ChartLocationFromHelmRef(). It contains any credentials and TLS
+	// settings for the Helm repository.
+	repoEntry *repo.Entry
 }
 
 // String returns a simplified string representation of the ChartLocation.
@@ -36,9 +57,26 @@ func (o *ChartLocation) String() string {
 	if o.IsOCI() {
 		return fmt.Sprintf("(oci) %q", o.OCIRepositoryPath())
 	}
+	if o.IsGit() {
+		return fmt.Sprintf(
+			"(git) repo: %q path: %q ref: %q",
+			o.GitRepositoryURL(), o.GitChartPath(), o.GitRef(),
+		)
+	}
 	return fmt.Sprintf("(helm) repo: %q chart: %q", o.Repository, o.Name)
 }
 
+// URLString returns the canonical URL of the ChartLocation, which
+// ChartLocationFromURL() parses back into an identical ChartLocation. For a
+// Helm repository ChartLocation, this is the Helm repository URL followed by
+// the Helm Chart name, e.g. `https://charts.bitnami.com/bitnami/nginx`.
+func (o *ChartLocation) URLString() string {
+	if o.URL != "" {
+		return o.URL
+	}
+	return o.HelmRepositoryURL() + "/" + o.Name
+}
+
 // IsLocal returns true if the ChartLocation refers to a local filesystem path,
 // false otherwise.
 func (o *ChartLocation) IsLocal() bool {
@@ -51,6 +89,65 @@ func (o *ChartLocation) IsOCI() bool {
 	return strings.HasPrefix(o.URL, "oci://")
 }
 
+// IsGit returns true if the ChartLocation refers to a Git repository URL,
+// false otherwise.
+func (o *ChartLocation) IsGit() bool {
+	return strings.HasPrefix(o.URL, "git+")
+}
+
+// splitGitURL returns the Git repository URL, path to the Helm Chart within
+// the Git repository and Git ref parts of the ChartLocation's URL.
+func (o *ChartLocation) splitGitURL() (string, string, string) {
+	if !o.IsGit() {
+		return "", "", ""
+	}
+	url := strings.TrimPrefix(o.URL, "git+")
+	url, query, _ := strings.Cut(url, "?")
+	var ref string
+	for _, param := range strings.Split(query, "&") {
+		if v, ok := strings.CutPrefix(param, "ref="); ok {
+			ref = v
+		}
+	}
+	// The path within the Git repository follows a double slash after the
+	// scheme's double slash, e.g. https://github.com/org/repo.git//charts/foo
+	scheme, rest, ok := strings.Cut(url, "://")
+	if !ok {
+		return url, "", ref
+	}
+	repoPath, chartPath, _ := strings.Cut(rest, "//")
+	return scheme + "://" + repoPath, strings.Trim(chartPath, "/"), ref
+}
+
+// GitRepositoryURL returns the URL of the Git repository stripped of the
+// `git+` prefix, any path to the Helm Chart and any ref. Therefore, if the
+// ChartLocation.URL is
+// `git+https://github.com/org/repo.git//charts/mychart?ref=v1.2.3`, the
+// returned string will be `https://github.com/org/repo.git`.
+//
+// Returns an empty string if the ChartLocation does not refer to a Git
+// repository.
+func (o *ChartLocation) GitRepositoryURL() string {
+	url, _, _ := o.splitGitURL()
+	return url
+}
+
+// GitChartPath returns the path to the Helm Chart within the Git repository,
+// or an empty string if the Helm Chart is at the root of the Git repository
+// or the ChartLocation does not refer to a Git repository.
+func (o *ChartLocation) GitChartPath() string {
+	_, path, _ := o.splitGitURL()
+	return path
+}
+
+// GitRef returns the Git ref (branch, tag or commit) in the ChartLocation's
+// URL, or an empty string if there is no ref or the ChartLocation does not
+// refer to a Git repository.
+func (o *ChartLocation) GitRef() string {
+	_, _, ref := o.splitGitURL()
+	return ref
+}
+
 // OCIRegistry returns the registry part of the OCI URL, or an empty string if
 // the ChartLocation does not refer to an OCI Artifact.
 //
@@ -110,32 +207,25 @@ func (o *ChartLocation) OCIRepositoryPath() string {
 // object referring to the ChartLocation, or nil if the ChartLocation does not
 // refer to an OCI Repository.
 //
-// The `oras.land/oras-go/v2/registry/remote.Repository` is constructed from
-// the Docker credential store.
+// By default, the `oras.land/oras-go/v2/registry/remote.Repository` is
+// constructed from the Docker credential store, falling back to the helm
+// CLI's registry configuration (see `helm registry login`). Supply OCIOptions
+// to use other credentials or connection settings, e.g.
+//
+// | repo, err := loc.OCIRepository(
+// |	helm.OCIWithBasicAuth("user", "pass"),
+// |	helm.OCIWithPlainHTTP(),
+// | )
 //
 // This is a helper method to avoid going through all the ORAS client
 // connection setup rigamorole.
-func (o *ChartLocation) OCIRepository() (*remote.Repository, error) {
+func (o *ChartLocation) OCIRepository(opt ...OCIOption) (*remote.Repository, error) {
 	if !o.IsOCI() {
 		return nil, fmt.Errorf(
 			"ChartLocation does not refer to an OCI Repository.",
 		)
 	}
-	ociRepo, err := remote.NewRepository(o.OCIRepositoryPath())
-	if err != nil {
-		return nil, err
-	}
-
-	client := &auth.Client{Cache: auth.NewCache()}
-
-	credStore, err := credentials.NewStoreFromDocker(credentials.StoreOptions{})
-	if err != nil {
-		return nil, err
-	} else {
-		client.Credential = credentials.Credential(credStore)
-		ociRepo.Client = client
-	}
-	return ociRepo, nil
+	return newOCIOptions(opt...).repository(o.OCIRepositoryPath())
 }
 
 // IsHelmRepository returns true if the ChartLocation refers to a Helm Chart
@@ -147,9 +237,9 @@ func (o *ChartLocation) IsHelmRepository() bool {
 // HelmRepositoryURL returns a string with the well-formed Helm repository URL
 // (including http(s):// prefix and no trailing slash). This URL does *not*
 // include the Helm Chart name. Returns an empty string if the ChartLocation
-// refers to an OCI Artifact or local file reference.
+// refers to an OCI Artifact, Git repository or local file reference.
 func (o *ChartLocation) HelmRepositoryURL() string {
-	if o.IsOCI() || o.IsLocal() {
+	if o.IsOCI() || o.IsLocal() || o.IsGit() {
 		return ""
 	}
 	return strings.TrimSuffix(o.Repository, "/")
@@ -157,7 +247,9 @@ func (o *ChartLocation) HelmRepositoryURL() string {
 
 // HelmRepository returns a `helm.sh/helm/v3/pkg/repo.Repo` object referring to
 // the ChartLocation, or nil if the ChartLocation does not refer to a Helm
-// Repository.
+// Repository. If the ChartLocation was resolved from a repository name by
+// ChartLocationFromHelmRef(), the Helm Repository's configuration includes any
+// credentials and TLS settings from the helm CLI's repository configuration.
 //
 // This is a helper method to avoid going through all the helm.sh/helm/v3 SDK
 // rigamorole around cli, settings, and getters.
@@ -172,6 +264,12 @@ func (o *ChartLocation) HelmRepository() (*repo.ChartRepository, error) {
 		Name: o.Name,
 		URL:  o.HelmRepositoryURL(),
 	}
+	if o.repoEntry != nil {
+		// copy the entry so that the ChartLocation's entry isn't modified
+		withConfig := *o.repoEntry
+		withConfig.URL = entry.URL
+		entry = &withConfig
+	}
 
 	settings := cli.New()
 	return repo.NewChartRepository(entry, getter.All(settings))
@@ -179,11 +277,35 @@ func (o *ChartLocation) HelmRepository() (*repo.ChartRepository, error) {
 
 // ChartLocationFromURL returns a ChartLocation given a supplied URL. If the
 // supplied URL is an HTTP(S) URL, it is expected to be in the format
-// http(s)://<helm repository>/<chart_name>.
+// http(s)://<helm repository>/<chart_name>. If the supplied URL is a Git
+// repository URL, it is expected to be in the format
+// git+<scheme>://<git repository>[//<path>][?ref=<ref>], where scheme is one of
+// https, http, ssh or file.
 func ChartLocationFromURL(url string) (*ChartLocation, error) {
 	if strings.HasPrefix(url, "file://") {
 		return &ChartLocation{URL: url}, nil
 	}
+	if strings.HasPrefix(url, "git+") {
+		loc := &ChartLocation{URL: url}
+		repoURL := loc.GitRepositoryURL()
+		if !slices.ContainsFunc(
+			[]string{"https://", "http://", "ssh://", "file://"},
+			func(scheme string) bool {
+				return strings.HasPrefix(repoURL, scheme) &&
+					len(repoURL) > len(scheme)
+			},
+		) {
+			return nil, fmt.Errorf(
+				"invalid URL format, expected "+
+					"git+<scheme>://<git repository>[//<path>][?ref=<ref>]: %s",
+				url,
+			)
+		}
+		if strings.HasPrefix(loc.GitRef(), "-") {
+			return nil, fmt.Errorf("invalid Git ref %q", loc.GitRef())
+		}
+		return loc, nil
+	}
 	if registry.IsOCI(url) {
 		parts := strings.Split(url, "/")
 		if len(parts) < 3 {
@@ -220,3 +342,86 @@ func ChartLocationFromURL(url string) (*ChartLocation, error) {
 	}
 	return &ChartLocation{Repository: repo, Name: chartName}, nil
 }
+
+// ChartLocationOptions contains options for resolving a ChartLocation.
+type ChartLocationOptions struct {
+	repositoryConfig string
+}
+
+// ChartLocationOption modifies how a ChartLocation is resolved.
+type ChartLocationOption func(*ChartLocationOptions)
+
+// ChartLocationWithRepositoryConfig returns a ChartLocationOption that sets
+// the path to the helm CLI's repository configuration file used to resolve
+// Helm repository names. Defaults to the helm CLI's default, i.e. the value of
+// the HELM_REPOSITORY_CONFIG environment variable or
+// `$HOME/.config/helm/repositories.yaml`.
+func ChartLocationWithRepositoryConfig(path string) ChartLocationOption {
+	return func(o *ChartLocationOptions) {
+		o.repositoryConfig = path
+	}
+}
+
+// ChartLocationFromHelmRef returns a ChartLocation given a chart reference in
+// the format accepted by the helm CLI, e.g. by `helm pull` or `helm install`.
+// The chart reference may be:
+//
+//   - <repository name>/<chart name>, e.g. "bitnami/nginx", where the
+//     repository name is resolved to a Helm repository URL using the helm
+//     CLI's repository configuration (see `helm repo add`)
+//   - a local path to an unpacked Helm Chart directory or Helm Chart archive
+//   - any URL accepted by ChartLocationFromURL()
+func ChartLocationFromHelmRef(
+	ctx context.Context,
+	ref string,
+	opt ...ChartLocationOption,
+) (*ChartLocation, error) {
+	ctx = debug.PushTrace(ctx, "helm:chart-location-from-helm-ref")
+	defer debug.PopTrace(ctx)
+	opts := &ChartLocationOptions{
+		repositoryConfig: cli.New().RepositoryConfig,
+	}
+	for _, o := range opt {
+		o(opts)
+	}
+	if strings.Contains(ref, "://") {
+		return ChartLocationFromURL(ref)
+	}
+	// Like the helm CLI, prefer an existing local path over a repository
+	// name.
+	if _, err := os.Stat(ref); err == nil {
+		absPath, err := filepath.Abs(ref)
+		if err != nil {
+			return nil, err
+		}
+		return &ChartLocation{URL: "file://" + absPath}, nil
+	}
+	repoName, chartName, ok := strings.Cut(ref, "/")
+	if !ok || repoName == "" || chartName == "" ||
+		strings.Contains(chartName, "/") {
+		return nil, fmt.Errorf(
+			"invalid chart reference, expected <repository>/<chart>: %s",
+			ref,
+		)
+	}
+	rf, err := repo.LoadFile(opts.repositoryConfig)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to load repository config %s: %w",
+			opts.repositoryConfig, err,
+		)
+	}
+	entry := rf.Get(repoName)
+	if entry == nil {
+		return nil, fmt.Errorf(
+			"repository %q not found in repository config %s",
+			repoName, opts.repositoryConfig,
+		)
+	}
+	debug.Printf(ctx, "resolved repository %q to %s\n", repoName, entry.URL)
+	return &ChartLocation{
+		Repository: strings.TrimSuffix(entry.URL, "/"),
+		Name:       chartName,
+		repoEntry:  entry,
+	}, nil
+}
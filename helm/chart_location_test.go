@@ -5,11 +5,15 @@
 package helm_test
 
 import (
+	"context"
 	"fmt"
+	"path/filepath"
 	"testing"
 
 	"github.com/jaypipes/kube-inspect/helm"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	helmrepo "helm.sh/helm/v3/pkg/repo"
 )
 
 func TestChartLocation(t *testing.T) {
@@ -184,3 +188,199 @@ func TestChartLocationHelmRepository(t *testing.T) {
 		})
 	}
 }
+
+func TestChartLocationGit(t *testing.T) {
+	tcs := []struct {
+		name             string
+		url              string
+		expErr           bool
+		expRepositoryURL string
+		expChartPath     string
+		expRef           string
+	}{
+		{
+			"https with path and ref",
+			"git+https://github.com/org/repo.git//charts/mychart?ref=v1.2.3",
+			false,
+			"https://github.com/org/repo.git",
+			"charts/mychart",
+			"v1.2.3",
+		},
+		{
+			"https without path or ref",
+			"git+https://github.com/org/repo.git",
+			false,
+			"https://github.com/org/repo.git",
+			"",
+			"",
+		},
+		{
+			"file with path",
+			"git+file:///srv/git/repo.git//charts/mychart/",
+			false,
+			"file:///srv/git/repo.git",
+			"charts/mychart",
+			"",
+		},
+		{
+			"ssh with ref",
+			"git+ssh://git@github.com/org/repo.git?ref=main",
+			false,
+			"ssh://git@github.com/org/repo.git",
+			"",
+			"main",
+		},
+		{
+			"error: unsupported scheme",
+			"git+ftp://example.com/repo.git",
+			true,
+			"",
+			"",
+			"",
+		},
+		{
+			"error: option ref",
+			"git+https://github.com/org/repo.git?ref=--upload-pack=evil",
+			true,
+			"",
+			"",
+			"",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(tt *testing.T) {
+			assert := assert.New(tt)
+			loc, err := helm.ChartLocationFromURL(tc.url)
+			if tc.expErr {
+				assert.NotNil(err)
+				return
+			}
+			assert.Nil(err)
+			assert.True(loc.IsGit())
+			assert.False(loc.IsLocal())
+			assert.False(loc.IsOCI())
+			assert.False(loc.IsHelmRepository())
+			assert.Empty(loc.HelmRepositoryURL())
+			assert.Equal(tc.expRepositoryURL, loc.GitRepositoryURL())
+			assert.Equal(tc.expChartPath, loc.GitChartPath())
+			assert.Equal(tc.expRef, loc.GitRef())
+		})
+	}
+}
+
+func TestChartLocationFromHelmRef(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+	repoConfig := filepath.Join(t.TempDir(), "repositories.yaml")
+	rf := helmrepo.NewFile()
+	rf.Add(
+		&helmrepo.Entry{
+			Name: "bitnami",
+			URL:  "https://charts.bitnami.com/bitnami/",
+		},
+		&helmrepo.Entry{
+			Name: "jetstack",
+			URL:  "https://charts.jetstack.io",
+		},
+	)
+	require.Nil(rf.WriteFile(repoConfig, 0o644))
+	umbrellaAbsDir, err := filepath.Abs(umbrellaLocalChartDir)
+	require.Nil(err)
+
+	tcs := []struct {
+		name   string
+		ref    string
+		exp    *helm.ChartLocation
+		expErr string
+	}{
+		{
+			"repository alias",
+			"bitnami/nginx",
+			&helm.ChartLocation{
+				Repository: "https://charts.bitnami.com/bitnami",
+				Name:       "nginx",
+			},
+			"",
+		},
+		{
+			"another repository alias",
+			"jetstack/cert-manager",
+			&helm.ChartLocation{
+				Repository: "https://charts.jetstack.io",
+				Name:       "cert-manager",
+			},
+			"",
+		},
+		{
+			"OCI URL",
+			"oci://quay.io/jetstack/charts/cert-manager",
+			&helm.ChartLocation{
+				URL: "oci://quay.io/jetstack/charts/cert-manager",
+			},
+			"",
+		},
+		{
+			"local path",
+			umbrellaLocalChartDir,
+			&helm.ChartLocation{URL: "file://" + umbrellaAbsDir},
+			"",
+		},
+		{
+			"error: unknown repository alias",
+			"stable/nginx",
+			nil,
+			`repository "stable" not found`,
+		},
+		{
+			"error: no repository alias",
+			"nginx",
+			nil,
+			"invalid chart reference",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(tt *testing.T) {
+			assert := assert.New(tt)
+			require := require.New(tt)
+			got, err := helm.ChartLocationFromHelmRef(
+				ctx, tc.ref, helm.ChartLocationWithRepositoryConfig(repoConfig),
+			)
+			if tc.expErr != "" {
+				require.NotNil(err)
+				assert.Contains(err.Error(), tc.expErr)
+				return
+			}
+			require.Nil(err)
+			assert.Equal(tc.exp.URL, got.URL)
+			assert.Equal(tc.exp.Repository, got.Repository)
+			assert.Equal(tc.exp.Name, got.Name)
+		})
+	}
+
+	_, err = helm.ChartLocationFromHelmRef(
+		ctx, "bitnami/nginx",
+		helm.ChartLocationWithRepositoryConfig(
+			filepath.Join(t.TempDir(), "missing.yaml"),
+		),
+	)
+	require.NotNil(err)
+}
+
+func TestChartLocationURLString(t *testing.T) {
+	locs := []*helm.ChartLocation{
+		{URL: "file:///path/to/chart.tgz"},
+		{URL: "oci://quay.io/jetstack/charts/cert-manager"},
+		{URL: "git+https://github.com/org/repo.git//charts/child?ref=v1.2.3"},
+		{Repository: "https://charts.jetstack.io", Name: "cert-manager"},
+		{Repository: "https://helm.sh/charts/stable", Name: "nginx"},
+	}
+	for _, loc := range locs {
+		t.Run(loc.URLString(), func(tt *testing.T) {
+			assert := assert.New(tt)
+			got, err := helm.ChartLocationFromURL(loc.URLString())
+			assert.Nil(err)
+			assert.Equal(loc, got)
+			assert.Equal(loc.URLString(), got.URLString())
+		})
+	}
+}
@@ -2,17 +2,17 @@ package helm
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/Masterminds/semver/v3"
-	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/samber/lo"
+	helmchart "helm.sh/helm/v3/pkg/chart"
 	helmrepo "helm.sh/helm/v3/pkg/repo"
-	"oras.land/oras-go/v2/content"
 	ociremote "oras.land/oras-go/v2/registry/remote"
 )
 
@@ -28,7 +28,13 @@ const (
 func defaultChartVersionsOptions() *ChartVersionsOptions {
 	return &ChartVersionsOptions{
 		limit:          DefaultChartVersionsLimit,
+		order:          ChartVersionsSemverDescending,
 		errorCollector: io.Discard,
+		cacheTTL:       DefaultCacheTTL,
+		ociFetch: ociFetchOptions{
+			concurrency: DefaultOCIFetchConcurrency,
+			timeout:     DefaultOCIFetchTimeout,
+		},
 	}
 }
 
@@ -40,10 +46,33 @@ type ChartVersion struct {
 	// that are published in OCI registries, this will always correspond to the
 	// tag for the Helm Chart OCI artifact.
 	Version string
+	// SemVer is the parsed Version.
+	SemVer *semver.Version
 	// PublishedOn is the date that the ChartVersion was published, if known.
 	PublishedOn string
 	// Deprecated indicates whether the ChartVersion is deprecated.
 	Deprecated bool
+	// AppVersion is the version of the application packaged by the Helm
+	// Chart, i.e. the `appVersion` field in the `Chart.yaml` file.
+	AppVersion string
+	// Description is the `description` field in the `Chart.yaml` file.
+	Description string
+	// KubeVersion is the SemVer constraint on the Kubernetes versions that
+	// the Helm Chart supports, i.e. the `kubeVersion` field in the
+	// `Chart.yaml` file, e.g. ">= 1.22.0-0".
+	KubeVersion string
+	// Digest is the digest of the Helm Chart archive, e.g. "sha256:1a2b...",
+	// if known.
+	Digest string
+	// OCIManifestDigest is the digest of the OCI manifest that the Helm Chart
+	// OCI artifact's tag refers to, e.g. "sha256:1a2b...". Pass it to
+	// WithChartVersion() to pin the Helm Chart immutably. Only populated for
+	// Helm Charts published in OCI registries.
+	OCIManifestDigest string
+	// URLs contains the URLs from which the Helm Chart archive can be
+	// downloaded. Only populated for Helm Charts published on Helm
+	// Repositories.
+	URLs []string
 }
 
 // ChartVersionFilter represents a filtering expression for ChartVersions
@@ -54,8 +83,23 @@ type ChartVersionsFilter func(ver *ChartVersion, _ int) bool
 type ChartVersionsOptions struct {
 	filters         []ChartVersionsFilter
 	limit           int
+	order           ChartVersionsOrder
 	ociFetchDetails bool
+	ociFetch        ociFetchOptions
+	oci             []OCIOption
+	kubeVersion     string
 	errorCollector  io.Writer
+	http            httpOptions
+	cacheDir        string
+	cacheTTL        time.Duration
+	chartName       string
+	// includePrerelease and includeDeprecated are only used by
+	// LatestChartVersion() and NextChartVersions().
+	includePrerelease bool
+	includeDeprecated bool
+	// excludeDeprecated skips deprecated versions. Like kubeVersion, it is
+	// applied to OCI ChartVersions only once their details are fetched.
+	excludeDeprecated bool
 }
 
 // ChartVersionsOption modifies the call to retrieve ChartVersions
@@ -70,10 +114,15 @@ func ChartVersionsWithFilter(filter ChartVersionsFilter) ChartVersionsOption {
 }
 
 // ChartVersionsWithOCIFetchDetails returns a ChartVersionsOption that enables
-// fetching of published dates and deprecation information. Note: for Helm
+// fetching of published dates, deprecation information and the AppVersion,
+// Description, KubeVersion and Digest of each ChartVersion. Note: for Helm
 // Charts published on OCI repositories, this dramatically increases the time
 // to fetch chart version information. Don't blame kube-inspect, though. Blame
 // the OCI distribution spec's terrible metadata handling queries.
+//
+// OCI manifests are fetched concurrently. See
+// ChartVersionsWithOCIFetchConcurrency(), ChartVersionsWithOCIFetchTimeout()
+// and ChartVersionsWithOCIFetchRateLimit().
 func ChartVersionsWithOCIFetchDetails() ChartVersionsOption {
 	return func(o *ChartVersionsOptions) {
 		o.ociFetchDetails = true
@@ -111,9 +160,13 @@ func ChartVersionsWithOCIFetchDetails() ChartVersionsOption {
 func ChartVersionsMatchingConstraint(con semver.Constraints) ChartVersionsOption {
 	return func(o *ChartVersionsOptions) {
 		filter := func(ver *ChartVersion, _ int) bool {
-			sv, err := semver.StrictNewVersion(ver.Version)
-			if err != nil {
-				return false
+			sv := ver.SemVer
+			if sv == nil {
+				var err error
+				sv, err = semver.StrictNewVersion(ver.Version)
+				if err != nil {
+					return false
+				}
 			}
 			return con.Check(sv)
 		}
@@ -121,15 +174,176 @@ func ChartVersionsMatchingConstraint(con semver.Constraints) ChartVersionsOption
 	}
 }
 
+// ChartVersionsCompatibleWithKubeVersion returns a ChartVersionsOption that
+// filters returned ChartVersions to those whose KubeVersion constraint is
+// satisfied by the supplied Kubernetes version, e.g. "1.29.3". ChartVersions
+// with no KubeVersion constraint are always returned.
+//
+// For Helm Charts published on OCI repositories, this implies
+// ChartVersionsWithOCIFetchDetails() for all versions. Versions whose details
+// cannot be fetched are returned.
+func ChartVersionsCompatibleWithKubeVersion(kubeVersion string) ChartVersionsOption {
+	return func(o *ChartVersionsOptions) {
+		o.kubeVersion = kubeVersion
+	}
+}
+
+// kubeCompatible returns true if the supplied ChartVersion's KubeVersion
+// constraint is satisfied by the Kubernetes version supplied with
+// ChartVersionsCompatibleWithKubeVersion().
+func (o *ChartVersionsOptions) kubeCompatible(cv *ChartVersion) bool {
+	if o.kubeVersion == "" || cv.KubeVersion == "" {
+		return true
+	}
+	vc, err := semver.NewConstraint(cv.KubeVersion)
+	if err != nil {
+		msg := fmt.Sprintf(
+			"kubeVersion %q of version %q was not a valid constraint\n",
+			cv.KubeVersion, cv.Version,
+		)
+		o.errorCollector.Write([]byte(msg)) // nolint:errcheck
+		return false
+	}
+	// Kubernetes distributions often report pre-release versions, e.g.
+	// "1.29.3-gke.1093000", which would never satisfy a constraint without a
+	// pre-release, so just check the release version.
+	kv, err := semver.NewVersion(o.kubeVersion)
+	if err != nil {
+		return false
+	}
+	release, _ := kv.SetPrerelease("")
+	return vc.Check(&release)
+}
+
+// include returns true if the supplied ChartVersion passes all supplied
+// filters and is compatible with any supplied Kubernetes version.
+func (o *ChartVersionsOptions) include(cv *ChartVersion) bool {
+	for _, filter := range o.filters {
+		if !filter(cv, 0) {
+			return false
+		}
+	}
+	return o.includeDetails(cv)
+}
+
+// includeDetails returns true if the supplied ChartVersion passes the checks
+// that depend on details only known for OCI ChartVersions once fetched, i.e.
+// deprecation and compatibility with any supplied Kubernetes version.
+func (o *ChartVersionsOptions) includeDetails(cv *ChartVersion) bool {
+	if o.excludeDeprecated && cv.Deprecated {
+		return false
+	}
+	return o.kubeCompatible(cv)
+}
+
+// validate returns an error if any option is invalid.
+func (o *ChartVersionsOptions) validate() error {
+	if o.kubeVersion != "" {
+		if _, err := semver.NewVersion(o.kubeVersion); err != nil {
+			return fmt.Errorf(
+				"invalid kube version %q: %w", o.kubeVersion, err,
+			)
+		}
+	}
+	return nil
+}
+
 // ChartVersionsWithLimit returns a ChartVersionOption that limits the number
 // of ChartVersions returned. The limit is applied to ChartVersions that match
-// all supplied filters.
+// all supplied filters, after they are ordered (see ChartVersionsWithOrder()).
 func ChartVersionsWithLimit(limit int) ChartVersionsOption {
 	return func(o *ChartVersionsOptions) {
 		o.limit = limit
 	}
 }
 
+// ChartVersionsOrder describes the order of returned ChartVersions.
+type ChartVersionsOrder int
+
+const (
+	// ChartVersionsSemverDescending orders ChartVersions from the highest to
+	// the lowest SemVer version. This is the default order.
+	ChartVersionsSemverDescending ChartVersionsOrder = iota
+	// ChartVersionsSemverAscending orders ChartVersions from the lowest to
+	// the highest SemVer version.
+	ChartVersionsSemverAscending
+	// ChartVersionsPublishedDescending orders ChartVersions from the most
+	// recently to the least recently published. ChartVersions with an unknown
+	// published date are ordered last, by descending SemVer version.
+	//
+	// For Helm Charts published on OCI repositories, this implies
+	// ChartVersionsWithOCIFetchDetails() for all matching versions.
+	ChartVersionsPublishedDescending
+	// ChartVersionsPublishedAscending orders ChartVersions from the least
+	// recently to the most recently published. ChartVersions with an unknown
+	// published date are ordered last, by ascending SemVer version.
+	//
+	// For Helm Charts published on OCI repositories, this implies
+	// ChartVersionsWithOCIFetchDetails() for all matching versions.
+	ChartVersionsPublishedAscending
+)
+
+// byPublishedDate returns true if the order is by published date.
+func (o ChartVersionsOrder) byPublishedDate() bool {
+	return o == ChartVersionsPublishedDescending ||
+		o == ChartVersionsPublishedAscending
+}
+
+// ChartVersionsWithOrder returns a ChartVersionOption that sets the order of
+// returned ChartVersions. The order is applied before any limit (see
+// ChartVersionsWithLimit()), so that, for example, the ten most recent
+// versions can be retrieved with:
+//
+// | helm.ChartVersionsFromLocation(
+// |	ctx, loc,
+// |	helm.ChartVersionsWithOrder(helm.ChartVersionsPublishedDescending),
+// |	helm.ChartVersionsWithLimit(10),
+// | )
+func ChartVersionsWithOrder(order ChartVersionsOrder) ChartVersionsOption {
+	return func(o *ChartVersionsOptions) {
+		o.order = order
+	}
+}
+
+// sortChartVersions sorts the supplied ChartVersions in the supplied order.
+func sortChartVersions(vers []*ChartVersion, order ChartVersionsOrder) {
+	semverLess := func(a, b *ChartVersion) bool {
+		if order == ChartVersionsSemverDescending ||
+			order == ChartVersionsPublishedDescending {
+			return b.SemVer.LessThan(a.SemVer)
+		}
+		return a.SemVer.LessThan(b.SemVer)
+	}
+	sort.SliceStable(vers, func(i, j int) bool {
+		a, b := vers[i], vers[j]
+		if !order.byPublishedDate() || a.PublishedOn == b.PublishedOn {
+			return semverLess(a, b)
+		}
+		// PublishedOn is formatted as time.DateTime, which sorts
+		// lexicographically.
+		switch {
+		case a.PublishedOn == "":
+			return false
+		case b.PublishedOn == "":
+			return true
+		case order == ChartVersionsPublishedDescending:
+			return a.PublishedOn > b.PublishedOn
+		default:
+			return a.PublishedOn < b.PublishedOn
+		}
+	})
+}
+
+// sortAndLimit sorts the supplied ChartVersions in the supplied order and
+// returns at most the supplied limit of them.
+func (o *ChartVersionsOptions) sortAndLimit(vers []*ChartVersion) []*ChartVersion {
+	sortChartVersions(vers, o.order)
+	if len(vers) > o.limit {
+		vers = vers[:o.limit]
+	}
+	return vers
+}
+
 // ChartVersionsWithErrorCollector returns a ChartVersionOption that writes any
 // errors found during retrieval of chart versions to the supplied io.Writer.
 func ChartVersionsWithErrorCollector(w io.Writer) ChartVersionsOption {
@@ -138,15 +352,56 @@ func ChartVersionsWithErrorCollector(w io.Writer) ChartVersionsOption {
 	}
 }
 
+// ChartVersionsWithHTTPClient returns a ChartVersionsOption that sets the
+// HTTP client used when downloading Helm repository index files.
+func ChartVersionsWithHTTPClient(client *http.Client) ChartVersionsOption {
+	return func(o *ChartVersionsOptions) {
+		o.http.client = client
+	}
+}
+
+// ChartVersionsWithBasicAuth returns a ChartVersionsOption that sets the
+// username and password sent, using HTTP basic authentication, when
+// downloading Helm repository index files.
+func ChartVersionsWithBasicAuth(username, password string) ChartVersionsOption {
+	return func(o *ChartVersionsOptions) {
+		o.http.username = username
+		o.http.password = password
+	}
+}
+
+// ChartVersionsWithBearerToken returns a ChartVersionsOption that sets the
+// token sent in an "Authorization: Bearer" header when downloading Helm
+// repository index files.
+func ChartVersionsWithBearerToken(token string) ChartVersionsOption {
+	return func(o *ChartVersionsOptions) {
+		o.http.bearerToken = token
+	}
+}
+
+// ChartVersionsWithCAFile returns a ChartVersionsOption that sets the path to
+// a PEM-encoded bundle of CA certificates used to verify the TLS certificate
+// of the Helm repository when downloading its index file.
+func ChartVersionsWithCAFile(path string) ChartVersionsOption {
+	return func(o *ChartVersionsOptions) {
+		o.http.caFile = path
+	}
+}
+
 // ChartVersionsFromLocation returns a slice of `ChartVersion`structs queried
-// from the OCI or Helm Repository associated with the supplied ChartLocation.
+// from the OCI Repository, Helm Repository, local path or Git repository
+// associated with the supplied ChartLocation.
 func ChartVersionsFromLocation(
 	ctx context.Context,
 	loc *ChartLocation,
 	opt ...ChartVersionsOption,
 ) ([]*ChartVersion, error) {
 	if loc.IsOCI() {
-		repo, err := loc.OCIRepository()
+		opts := defaultChartVersionsOptions()
+		for _, o := range opt {
+			o(opts)
+		}
+		repo, err := loc.OCIRepository(opts.oci...)
 		if err != nil {
 			return nil, err
 		}
@@ -159,6 +414,17 @@ func ChartVersionsFromLocation(
 		return ChartVersionsFromHelmRepository(
 			ctx, repo, loc.Name, opt...,
 		)
+	} else if loc.IsLocal() {
+		if loc.Name != "" {
+			opt = append(opt, ChartVersionsWithChartName(loc.Name))
+		}
+		return ChartVersionsFromLocalPath(
+			ctx, strings.TrimPrefix(loc.URL, "file://"), opt...,
+		)
+	} else if loc.IsGit() {
+		return ChartVersionsFromGitRepository(
+			ctx, loc.GitRepositoryURL(), loc.GitChartPath(), opt...,
+		)
 	}
 	return nil, fmt.Errorf(
 		"unable to find chart versions from ChartLocation",
@@ -176,16 +442,15 @@ func ChartVersionsFromOCIRepository(
 	for _, o := range opt {
 		o(opts)
 	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
 	out := []*ChartVersion{}
-	matched := 0
 	// We need to track matched tags because sometimes chart authors publish
 	// tags that have the same version with and without a "v" prefix :(
 	seenTags := []string{}
 	err := repo.Tags(ctx, "", func(tags []string) error {
 		for _, tag := range tags {
-			if matched >= opts.limit {
-				break
-			}
 			// We need to filter out non-chart tags (like SBOMs and
 			// signatures). The most accurate way of doing this is using the
 			// semver.StrictNewVersion() since Helm Chart Versions are required
@@ -195,7 +460,7 @@ func ChartVersionsFromOCIRepository(
 			// and use the semver.StrictNewVersion() function on the stripped
 			// string.
 			tag = strings.TrimPrefix(tag, "v")
-			_, err := semver.StrictNewVersion(tag)
+			sv, err := semver.StrictNewVersion(tag)
 			if err != nil {
 				msg := fmt.Sprintf(
 					"version %q was not valid semver\n", tag,
@@ -203,7 +468,7 @@ func ChartVersionsFromOCIRepository(
 				opts.errorCollector.Write([]byte(msg)) // nolint:errcheck
 				continue
 			}
-			cv := &ChartVersion{Version: tag}
+			cv := &ChartVersion{Version: tag, SemVer: sv}
 			exclude := false
 			for _, filter := range opts.filters {
 				if !filter(cv, 0) {
@@ -214,7 +479,6 @@ func ChartVersionsFromOCIRepository(
 			if exclude || lo.Contains(seenTags, tag) {
 				continue
 			}
-			matched++
 			seenTags = append(seenTags, tag)
 			out = append(out, cv)
 		}
@@ -223,66 +487,38 @@ func ChartVersionsFromOCIRepository(
 	if err != nil {
 		return nil, err
 	}
-	if opts.ociFetchDetails {
-		// Now we need to get the published on dates by examining the OCI manifests
-		// associated with each matched version tag. sigh, I hate the OCI metadata
-		// retrieval APIs and how they force you into inefficient N+1 queries :(
-		for x, cv := range out {
-			desc, rc, err := repo.FetchReference(ctx, cv.Version)
-			if err != nil {
-				msg := fmt.Sprintf(
-					"failed to fetch reference for version %q: %s\n",
-					cv.Version, err,
-				)
-				opts.errorCollector.Write([]byte(msg)) // nolint:errcheck
-				continue
-			}
-			defer rc.Close()
-			manifestBytes, err := content.ReadAll(rc, desc)
-			if err != nil {
-				msg := fmt.Sprintf(
-					"failed to read OCI descriptor for version %q: %s\n",
-					cv.Version, err,
-				)
-				opts.errorCollector.Write([]byte(msg)) // nolint:errcheck
-				continue
-			}
-
-			var manifest ocispec.Manifest
-			if err = json.Unmarshal(manifestBytes, &manifest); err != nil {
-				msg := fmt.Sprintf(
-					"failed to unmarshal version %q into manifest: %s\n"+
-						"manifest bytes: %s\n",
-					cv.Version, err, string(manifestBytes),
-				)
-				opts.errorCollector.Write([]byte(msg)) // nolint:errcheck
-				continue
-			}
-
-			for k, v := range manifest.Annotations {
-				if k == "org.opencontainers.image.created" {
-					publishedOn, err := time.Parse(time.RFC3339, v)
-					if err != nil {
-						msg := fmt.Sprintf(
-							"failed to parse org.opencontainers.image.created "+
-								"of %q for version %q: %s\n",
-							v, cv.Version, err,
-						)
-						opts.errorCollector.Write([]byte(msg)) // nolint:errcheck
-						continue
-					}
-					cv.PublishedOn = publishedOn.Format(time.DateTime)
-					out[x] = cv
-					break
-				}
-			}
-		}
+	// Ordering by published date and filtering by KubeVersion require the
+	// details of all matching versions, so we need to fetch details before
+	// applying the limit.
+	// Deprecation is only known once details are fetched, so deprecated
+	// versions can only be skipped when fetching details.
+	detailsFirst := opts.order.byPublishedDate() || opts.kubeVersion != "" ||
+		(opts.excludeDeprecated && opts.ociFetchDetails)
+	if detailsFirst {
+		fetchOCIChartVersionDetails(ctx, repo, out, opts)
+		out = lo.Filter(out, func(cv *ChartVersion, _ int) bool {
+			return opts.includeDetails(cv)
+		})
+	}
+	out = opts.sortAndLimit(out)
+	switch {
+	case detailsFirst:
+	case opts.ociFetchDetails:
+		fetchOCIChartVersionDetails(ctx, repo, out, opts)
+	default:
+		resolveOCIManifestDigests(ctx, repo, out, opts)
 	}
 	return out, nil
 }
 
 // ChartVersionsFromHelmRepository returns a slice of `ChartVersion` structs
 // queried from the supplied Helm Repository and chart name.
+//
+// Any username, password, CA file, TLS client certificate and TLS
+// verification setting in the Helm Repository's configuration are used when
+// downloading the index file. The username and password are overridden by
+// ChartVersionsWithBasicAuth() or ChartVersionsWithBearerToken() and the CA
+// file by ChartVersionsWithCAFile().
 func ChartVersionsFromHelmRepository(
 	ctx context.Context,
 	repo *helmrepo.ChartRepository,
@@ -293,26 +529,23 @@ func ChartVersionsFromHelmRepository(
 	for _, o := range opt {
 		o(opts)
 	}
-	indexPath, err := repo.DownloadIndexFile()
-	if err != nil {
+	if err := opts.validate(); err != nil {
 		return nil, err
 	}
-
-	indexFile, err := helmrepo.LoadIndexFile(indexPath)
+	indexFile, err := fetchIndexFile(
+		ctx, repo.Config.URL, opts.http.withRepositoryConfig(repo.Config),
+		newChartCache(opts.cacheDir, opts.cacheTTL),
+	)
 	if err != nil {
 		return nil, err
 	}
-	matched := 0
 	out := []*ChartVersion{}
 	for _, cv := range indexFile.Entries[chartName] {
-		if matched >= opts.limit {
-			break
-		}
 		// Yep, Helm Repositories regularly publish non-compliant SemVer2 chart
 		// versions, so we need to be lenient here and auto-trim the "v" prefix
 		// while checking for valid chart versions.
 		ver := strings.TrimPrefix(cv.Version, "v")
-		_, err := semver.StrictNewVersion(ver)
+		sv, err := semver.StrictNewVersion(ver)
 		if err != nil {
 			msg := fmt.Sprintf(
 				"version %q was not valid semver.", ver,
@@ -324,23 +557,53 @@ func ChartVersionsFromHelmRepository(
 		if !cv.Created.IsZero() {
 			publishedOn = cv.Created.Format(time.DateTime)
 		}
+		var digest string
+		if cv.Digest != "" {
+			digest = "sha256:" + cv.Digest
+		}
+		urls := make([]string, 0, len(cv.URLs))
+		for _, u := range cv.URLs {
+			// Archive URLs may be relative to the repository URL.
+			if resolved, err := helmrepo.ResolveReferenceURL(
+				repo.Config.URL, u,
+			); err == nil {
+				u = resolved
+			}
+			urls = append(urls, u)
+		}
 		cv := &ChartVersion{
 			Version:     ver,
+			SemVer:      sv,
 			PublishedOn: publishedOn,
 			Deprecated:  cv.Deprecated,
+			AppVersion:  cv.AppVersion,
+			Description: cv.Description,
+			KubeVersion: cv.KubeVersion,
+			Digest:      digest,
+			URLs:        urls,
 		}
-		exclude := false
-		for _, filter := range opts.filters {
-			if !filter(cv, 0) {
-				exclude = true
-				break
-			}
-		}
-		if exclude {
+		if !opts.include(cv) {
 			continue
 		}
-		matched++
 		out = append(out, cv)
 	}
-	return out, nil
+	return opts.sortAndLimit(out), nil
+}
+
+// chartVersionFromMetadata returns a ChartVersion describing the supplied
+// Helm Chart metadata.
+func chartVersionFromMetadata(md *helmchart.Metadata) (*ChartVersion, error) {
+	ver := strings.TrimPrefix(md.Version, "v")
+	sv, err := semver.StrictNewVersion(ver)
+	if err != nil {
+		return nil, fmt.Errorf("version %q was not valid semver", ver)
+	}
+	return &ChartVersion{
+		Version:     ver,
+		SemVer:      sv,
+		Deprecated:  md.Deprecated,
+		AppVersion:  md.AppVersion,
+		Description: md.Description,
+		KubeVersion: md.KubeVersion,
+	}, nil
 }
@@ -0,0 +1,304 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/time/rate"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/registry"
+	"oras.land/oras-go/v2/content"
+	ociremote "oras.land/oras-go/v2/registry/remote"
+
+	"github.com/jaypipes/kube-inspect/debug"
+)
+
+const (
+	// DefaultOCIFetchConcurrency is the number of OCI manifests that are
+	// fetched or resolved concurrently if
+	// ChartVersionsWithOCIFetchConcurrency() is not set.
+	DefaultOCIFetchConcurrency = 8
+	// DefaultOCIFetchTimeout is the timeout for fetching or resolving a
+	// single OCI manifest if ChartVersionsWithOCIFetchTimeout() is not set.
+	DefaultOCIFetchTimeout = 30 * time.Second
+)
+
+// ociFetchOptions contains options for fetching the OCI manifests of Helm
+// Chart versions.
+type ociFetchOptions struct {
+	// concurrency is the maximum number of OCI manifests fetched at once.
+	concurrency int
+	// timeout is the timeout for fetching a single OCI manifest.
+	timeout time.Duration
+	// rateLimit is the maximum number of OCI manifest fetches started per
+	// second. Zero means unlimited.
+	rateLimit float64
+}
+
+// ChartVersionsWithOCIFetchConcurrency returns a ChartVersionsOption that
+// sets the maximum number of OCI manifests that are fetched concurrently, or
+// resolved concurrently if ChartVersionsWithOCIFetchDetails() is not set.
+// Defaults to DefaultOCIFetchConcurrency.
+func ChartVersionsWithOCIFetchConcurrency(n int) ChartVersionsOption {
+	return func(o *ChartVersionsOptions) {
+		if n > 0 {
+			o.ociFetch.concurrency = n
+		}
+	}
+}
+
+// ChartVersionsWithOCIFetchTimeout returns a ChartVersionsOption that sets the
+// timeout for fetching or resolving a single OCI manifest. Versions whose OCI
+// manifest cannot be fetched within the timeout have no published date or
+// OCIManifestDigest, and the timeout is written to any error collector (see
+// ChartVersionsWithErrorCollector()). Defaults to DefaultOCIFetchTimeout.
+func ChartVersionsWithOCIFetchTimeout(timeout time.Duration) ChartVersionsOption {
+	return func(o *ChartVersionsOptions) {
+		o.ociFetch.timeout = timeout
+	}
+}
+
+// ChartVersionsWithOCIFetchRateLimit returns a ChartVersionsOption that limits
+// the number of OCI manifest fetches or resolutions started per second.
+// Useful for registries that throttle clients, e.g. Docker Hub. By default,
+// fetches are not rate limited.
+func ChartVersionsWithOCIFetchRateLimit(perSecond float64) ChartVersionsOption {
+	return func(o *ChartVersionsOptions) {
+		o.ociFetch.rateLimit = perSecond
+	}
+}
+
+// lockedWriter serializes writes to an io.Writer.
+type lockedWriter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func (w *lockedWriter) Write(b []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	return w.w.Write(b)
+}
+
+// fetchOCIChartVersionDetails fills in the details of the supplied
+// ChartVersions by examining the OCI manifest and config for each version's
+// tag.
+//
+// sigh, I hate the OCI metadata retrieval APIs and how they force you into
+// inefficient N+1 queries :( To keep this bearable, the OCI manifests are
+// fetched by a bounded pool of workers.
+func fetchOCIChartVersionDetails(
+	ctx context.Context,
+	repo *ociremote.Repository,
+	out []*ChartVersion,
+	opts *ChartVersionsOptions,
+) {
+	ctx = debug.PushTrace(ctx, "helm:fetch-oci-chart-version-details")
+	defer debug.PopTrace(ctx)
+	forEachOCIChartVersion(
+		ctx, out, opts,
+		func(ctx context.Context, cv *ChartVersion, errs io.Writer) error {
+			return fetchOCIChartVersionDetail(ctx, repo, cv, errs)
+		},
+	)
+}
+
+// resolveOCIManifestDigests fills in the OCIManifestDigest of the supplied
+// ChartVersions by resolving each version's tag, which only requires a HEAD
+// request per tag rather than fetching the OCI manifest and config.
+func resolveOCIManifestDigests(
+	ctx context.Context,
+	repo *ociremote.Repository,
+	out []*ChartVersion,
+	opts *ChartVersionsOptions,
+) {
+	ctx = debug.PushTrace(ctx, "helm:resolve-oci-manifest-digests")
+	defer debug.PopTrace(ctx)
+	forEachOCIChartVersion(
+		ctx, out, opts,
+		func(ctx context.Context, cv *ChartVersion, _ io.Writer) error {
+			desc, err := repo.Resolve(ctx, cv.Version)
+			if err != nil {
+				return fmt.Errorf(
+					"failed to resolve reference for version %q: %w",
+					cv.Version, err,
+				)
+			}
+			cv.OCIManifestDigest = desc.Digest.String()
+			return nil
+		},
+	)
+}
+
+// forEachOCIChartVersion calls the supplied function for each of the supplied
+// ChartVersions using a bounded pool of workers, honouring the OCI fetch
+// concurrency, timeout and rate limit options. Errors are written to the
+// error collector.
+func forEachOCIChartVersion(
+	ctx context.Context,
+	out []*ChartVersion,
+	opts *ChartVersionsOptions,
+	fn func(context.Context, *ChartVersion, io.Writer) error,
+) {
+	errs := &lockedWriter{w: opts.errorCollector}
+	var limiter *rate.Limiter
+	if opts.ociFetch.rateLimit > 0 {
+		limiter = rate.NewLimiter(rate.Limit(opts.ociFetch.rateLimit), 1)
+	}
+	workers := min(opts.ociFetch.concurrency, len(out))
+	debug.Printf(
+		ctx, "fetching %d OCI manifests with %d workers\n", len(out), workers,
+	)
+	work := make(chan *ChartVersion)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for cv := range work {
+				err := fetchWithLimits(ctx, cv, limiter, errs, opts, fn)
+				if err != nil {
+					errs.Write([]byte(err.Error() + "\n")) // nolint:errcheck
+				}
+			}
+		}()
+	}
+	for _, cv := range out {
+		work <- cv
+	}
+	close(work)
+	wg.Wait()
+}
+
+// fetchWithLimits calls the supplied function for the supplied ChartVersion
+// once the rate limiter allows, with the OCI fetch timeout applied.
+func fetchWithLimits(
+	ctx context.Context,
+	cv *ChartVersion,
+	limiter *rate.Limiter,
+	errs io.Writer,
+	opts *ChartVersionsOptions,
+	fn func(context.Context, *ChartVersion, io.Writer) error,
+) error {
+	if limiter != nil {
+		if err := limiter.Wait(ctx); err != nil {
+			return fmt.Errorf(
+				"failed to fetch reference for version %q: %w",
+				cv.Version, err,
+			)
+		}
+	}
+	if opts.ociFetch.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.ociFetch.timeout)
+		defer cancel()
+	}
+	return fn(ctx, cv, errs)
+}
+
+// fetchOCIChartVersionDetail fills in the published date, digests and Helm
+// Chart metadata of the supplied ChartVersion by examining the OCI manifest
+// and config for the version's tag. Problems that don't prevent the rest of
+// the details from being filled in are written to the supplied io.Writer.
+func fetchOCIChartVersionDetail(
+	ctx context.Context,
+	repo *ociremote.Repository,
+	cv *ChartVersion,
+	errs io.Writer,
+) error {
+	desc, rc, err := repo.FetchReference(ctx, cv.Version)
+	if err != nil {
+		return fmt.Errorf(
+			"failed to fetch reference for version %q: %w", cv.Version, err,
+		)
+	}
+	defer rc.Close()
+	cv.OCIManifestDigest = desc.Digest.String()
+	manifestBytes, err := content.ReadAll(rc, desc)
+	if err != nil {
+		return fmt.Errorf(
+			"failed to read OCI descriptor for version %q: %w",
+			cv.Version, err,
+		)
+	}
+
+	var manifest ocispec.Manifest
+	if err = json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return fmt.Errorf(
+			"failed to unmarshal version %q into manifest: %w\n"+
+				"manifest bytes: %s",
+			cv.Version, err, string(manifestBytes),
+		)
+	}
+
+	for _, layer := range manifest.Layers {
+		if layer.MediaType == registry.ChartLayerMediaType ||
+			layer.MediaType == registry.LegacyChartLayerMediaType {
+			cv.Digest = layer.Digest.String()
+			break
+		}
+	}
+	if v, ok := manifest.Annotations[ocispec.AnnotationCreated]; ok {
+		publishedOn, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			// The rest of the details are still useful without the
+			// published date.
+			msg := fmt.Sprintf(
+				"failed to parse %s of %q for version %q: %s\n",
+				ocispec.AnnotationCreated, v, cv.Version, err,
+			)
+			errs.Write([]byte(msg)) // nolint:errcheck
+		} else {
+			cv.PublishedOn = publishedOn.Format(time.DateTime)
+		}
+	}
+	if manifest.Config.MediaType != registry.ConfigMediaType {
+		return nil
+	}
+	// The Helm Chart OCI artifact's config is the Chart.yaml metadata
+	// encoded as JSON.
+	md, err := fetchOCIChartMetadata(ctx, repo, manifest.Config)
+	if err != nil {
+		return fmt.Errorf(
+			"failed to fetch chart metadata for version %q: %w",
+			cv.Version, err,
+		)
+	}
+	cv.AppVersion = md.AppVersion
+	cv.Description = md.Description
+	cv.KubeVersion = md.KubeVersion
+	cv.Deprecated = md.Deprecated
+	return nil
+}
+
+// fetchOCIChartMetadata fetches the Helm Chart OCI artifact config with the
+// supplied descriptor and returns the Helm Chart metadata it contains.
+func fetchOCIChartMetadata(
+	ctx context.Context,
+	repo *ociremote.Repository,
+	desc ocispec.Descriptor,
+) (*helmchart.Metadata, error) {
+	rc, err := repo.Fetch(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := content.ReadAll(rc, desc)
+	if err != nil {
+		return nil, err
+	}
+	md := &helmchart.Metadata{}
+	if err := json.Unmarshal(b, md); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
@@ -0,0 +1,440 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	kihelm "github.com/jaypipes/kube-inspect/helm"
+	godigest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/registry"
+	ociremote "oras.land/oras-go/v2/registry/remote"
+)
+
+// fakeOCIRegistry is an in-process stand-in for an OCI distribution registry
+// that serves tag listings, manifests (by tag or digest), configs and chart
+// layers for a single repository.
+type fakeOCIRegistry struct {
+	sync.Mutex
+	// created is keyed by tag and contains the value of the manifest's
+	// org.opencontainers.image.created annotation.
+	created map[string]time.Time
+	// createdAnnotation is keyed by tag and overrides the value of the
+	// manifest's org.opencontainers.image.created annotation. Optional.
+	createdAnnotation map[string]string
+	// layerMediaType is the media type of the chart layer. Defaults to
+	// registry.ChartLayerMediaType.
+	layerMediaType string
+	// metadata is keyed by tag and contains the Helm Chart metadata served
+	// as the OCI artifact's config. Optional.
+	metadata map[string]*helmchart.Metadata
+	// charts is keyed by tag and contains the Helm Chart archive served as
+	// the OCI artifact's chart layer. Optional.
+	charts map[string][]byte
+	// authorize, if set, returns true if the request is authorized. Requests
+	// that are not authorized get a 401 response with the challenge in the
+	// WWW-Authenticate header.
+	authorize func(*http.Request) bool
+	challenge string
+	// delay is the time taken to serve each manifest.
+	delay time.Duration
+	// slow contains tags whose manifest takes much longer to serve.
+	slow map[string]bool
+	// inFlight and maxInFlight track concurrent manifest requests.
+	inFlight    int
+	maxInFlight int
+	// fetched records the time that each manifest request was received.
+	fetched []time.Time
+}
+
+func (r *fakeOCIRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.authorize != nil && !r.authorize(req) {
+		w.Header().Set("WWW-Authenticate", r.challenge)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	path := req.URL.Path
+	switch {
+	case path == "/v2/":
+		w.WriteHeader(http.StatusOK)
+	case strings.HasSuffix(path, "/tags/list"):
+		tags := []string{}
+		for tag := range r.created {
+			tags = append(tags, tag)
+		}
+		// Non-chart tags, e.g. signatures, are also published.
+		tags = append(tags, "sha256-abcdef.sig")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"tags": tags}) // nolint:errcheck
+	case strings.Contains(path, "/manifests/"):
+		tag := path[strings.LastIndex(path, "/")+1:]
+		r.Lock()
+		r.inFlight++
+		r.maxInFlight = max(r.maxInFlight, r.inFlight)
+		r.fetched = append(r.fetched, time.Now())
+		r.Unlock()
+		defer func() {
+			r.Lock()
+			r.inFlight--
+			r.Unlock()
+		}()
+		delay := r.delay
+		if r.slow[tag] {
+			delay = time.Second
+		}
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return
+		}
+		// Manifests may also be referenced by digest.
+		for candidate := range r.created {
+			if m, _ := r.artifact(candidate); ociDigest(m) == tag {
+				tag = candidate
+			}
+		}
+		if _, ok := r.created[tag]; !ok {
+			http.NotFound(w, req)
+			return
+		}
+		manifest, _ := r.artifact(tag)
+		serveOCIContent(w, ocispec.MediaTypeImageManifest, manifest)
+	case strings.Contains(path, "/blobs/"):
+		digest := path[strings.LastIndex(path, "/")+1:]
+		for tag := range r.created {
+			_, config := r.artifact(tag)
+			if ociDigest(config) == digest {
+				serveOCIContent(w, registry.ConfigMediaType, config)
+				return
+			}
+			if chart := r.charts[tag]; chart != nil && ociDigest(chart) == digest {
+				serveOCIContent(w, registry.ChartLayerMediaType, chart)
+				return
+			}
+		}
+		http.NotFound(w, req)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// artifact returns the OCI manifest and config of the Helm Chart OCI artifact
+// with the supplied tag.
+func (r *fakeOCIRegistry) artifact(tag string) ([]byte, []byte) {
+	md := r.metadata[tag]
+	if md == nil {
+		md = &helmchart.Metadata{
+			APIVersion: helmchart.APIVersionV2,
+			Name:       "child",
+			Version:    tag,
+		}
+	}
+	config, _ := json.Marshal(md)
+	layer := r.charts[tag]
+	if layer == nil {
+		// The chart archive itself is not served.
+		layer = []byte("chart " + tag)
+	}
+	created := r.created[tag].Format(time.RFC3339)
+	if v, ok := r.createdAnnotation[tag]; ok {
+		created = v
+	}
+	layerMediaType := registry.ChartLayerMediaType
+	if r.layerMediaType != "" {
+		layerMediaType = r.layerMediaType
+	}
+	manifest := ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config: ocispec.Descriptor{
+			MediaType: registry.ConfigMediaType,
+			Digest:    godigest.Digest(ociDigest(config)),
+			Size:      int64(len(config)),
+		},
+		Layers: []ocispec.Descriptor{
+			{
+				MediaType: layerMediaType,
+				Digest:    godigest.Digest(ociDigest(layer)),
+				Size:      int64(len(layer)),
+			},
+		},
+		Annotations: map[string]string{
+			ocispec.AnnotationCreated: created,
+		},
+	}
+	manifest.SchemaVersion = 2
+	b, _ := json.Marshal(manifest)
+	return b, config
+}
+
+func ociDigest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func serveOCIContent(w http.ResponseWriter, mediaType string, b []byte) {
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(b)))
+	w.Header().Set("Docker-Content-Digest", ociDigest(b))
+	w.Write(b) // nolint:errcheck
+}
+
+// serveFakeOCIRegistry starts the supplied fakeOCIRegistry and returns an
+// ORAS repository for its "charts/child" repository.
+func serveFakeOCIRegistry(
+	t *testing.T,
+	reg *fakeOCIRegistry,
+) *ociremote.Repository {
+	srv := httptest.NewServer(reg)
+	t.Cleanup(srv.Close)
+	repo, err := ociremote.NewRepository(
+		strings.TrimPrefix(srv.URL, "http://") + "/charts/child",
+	)
+	require.Nil(t, err)
+	repo.PlainHTTP = true
+	return repo
+}
+
+// publishedVersions returns n versions "1.0.0", "1.0.1", ... published one
+// day apart, in reverse SemVer order.
+func publishedVersions(n int) map[string]time.Time {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	created := map[string]time.Time{}
+	for x := range n {
+		created[fmt.Sprintf("1.0.%d", x)] = start.AddDate(0, 0, n-x)
+	}
+	return created
+}
+
+func TestChartVersionsFromOCIRepositoryFetchDetails(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	reg := &fakeOCIRegistry{
+		created: publishedVersions(20),
+		delay:   20 * time.Millisecond,
+	}
+	repo := serveFakeOCIRegistry(t, reg)
+
+	vers, err := kihelm.ChartVersionsFromOCIRepository(
+		ctx, repo,
+		kihelm.ChartVersionsWithOCIFetchDetails(),
+		kihelm.ChartVersionsWithOCIFetchConcurrency(4),
+	)
+	require.Nil(err)
+	require.Len(vers, 20)
+	for _, cv := range vers {
+		exp := reg.created[cv.Version].Format(time.DateTime)
+		assert.Equal(exp, cv.PublishedOn, cv.Version)
+	}
+	assert.LessOrEqual(reg.maxInFlight, 4)
+	assert.Greater(reg.maxInFlight, 1)
+
+	// Ordering by published date fetches the details of all versions before
+	// applying the limit.
+	vers, err = kihelm.ChartVersionsFromOCIRepository(
+		ctx, repo,
+		kihelm.ChartVersionsWithOrder(kihelm.ChartVersionsPublishedDescending),
+		kihelm.ChartVersionsWithLimit(3),
+	)
+	require.Nil(err)
+	assert.Equal(
+		[]string{"1.0.0", "1.0.1", "1.0.2"}, chartVersionStrings(vers),
+	)
+}
+
+func TestChartVersionsFromOCIRepositoryFetchTimeout(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	reg := &fakeOCIRegistry{
+		created: publishedVersions(5),
+		slow:    map[string]bool{"1.0.3": true},
+	}
+	repo := serveFakeOCIRegistry(t, reg)
+
+	errs := &strings.Builder{}
+	start := time.Now()
+	vers, err := kihelm.ChartVersionsFromOCIRepository(
+		ctx, repo,
+		kihelm.ChartVersionsWithOCIFetchDetails(),
+		kihelm.ChartVersionsWithOCIFetchTimeout(50*time.Millisecond),
+		kihelm.ChartVersionsWithErrorCollector(errs),
+	)
+	require.Nil(err)
+	assert.Less(time.Since(start), time.Second)
+	require.Len(vers, 5)
+	for _, cv := range vers {
+		if cv.Version == "1.0.3" {
+			assert.Empty(cv.PublishedOn)
+			continue
+		}
+		assert.NotEmpty(cv.PublishedOn, cv.Version)
+	}
+	assert.Contains(errs.String(), `failed to fetch reference for version "1.0.3"`)
+}
+
+func TestChartVersionsFromOCIRepositoryFetchRateLimit(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	reg := &fakeOCIRegistry{
+		created: publishedVersions(5),
+	}
+	repo := serveFakeOCIRegistry(t, reg)
+
+	vers, err := kihelm.ChartVersionsFromOCIRepository(
+		ctx, repo,
+		kihelm.ChartVersionsWithOCIFetchDetails(),
+		kihelm.ChartVersionsWithOCIFetchRateLimit(20),
+	)
+	require.Nil(err)
+	require.Len(vers, 5)
+	require.Len(reg.fetched, 5)
+	// At 20 fetches per second, the five fetches are started at least 200ms
+	// apart in total. Allow some slack for timer granularity.
+	elapsed := reg.fetched[4].Sub(reg.fetched[0])
+	assert.GreaterOrEqual(elapsed, 150*time.Millisecond)
+}
+
+func TestChartVersionsFromOCIRepositoryMetadata(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	reg := &fakeOCIRegistry{
+		created: publishedVersions(3),
+		metadata: map[string]*helmchart.Metadata{
+			"1.0.0": {
+				Name:        "child",
+				Version:     "1.0.0",
+				AppVersion:  "1.13.0",
+				KubeVersion: ">= 1.20.0-0, < 1.25.0-0",
+			},
+			"1.0.1": {
+				Name:        "child",
+				Version:     "1.0.1",
+				AppVersion:  "1.14.0",
+				Description: "A child chart",
+				KubeVersion: ">= 1.22.0-0",
+				Deprecated:  true,
+			},
+		},
+	}
+	repo := serveFakeOCIRegistry(t, reg)
+
+	vers, err := kihelm.ChartVersionsFromOCIRepository(
+		ctx, repo,
+		kihelm.ChartVersionsWithOCIFetchDetails(),
+		kihelm.ChartVersionsWithOrder(kihelm.ChartVersionsSemverAscending),
+	)
+	require.Nil(err)
+	require.Len(vers, 3)
+	cv := vers[1]
+	assert.Equal("1.0.1", cv.Version)
+	assert.Equal("1.14.0", cv.AppVersion)
+	assert.Equal("A child chart", cv.Description)
+	assert.Equal(">= 1.22.0-0", cv.KubeVersion)
+	assert.True(cv.Deprecated)
+	assert.Equal(ociDigest([]byte("chart 1.0.1")), cv.Digest)
+	manifest, _ := reg.artifact("1.0.1")
+	assert.Equal(ociDigest(manifest), cv.OCIManifestDigest)
+	assert.Empty(cv.URLs)
+
+	// Filtering by KubeVersion fetches details without
+	// ChartVersionsWithOCIFetchDetails().
+	vers, err = kihelm.ChartVersionsFromOCIRepository(
+		ctx, repo,
+		kihelm.ChartVersionsCompatibleWithKubeVersion("1.21.4"),
+	)
+	require.Nil(err)
+	assert.Equal([]string{"1.0.2", "1.0.0"}, chartVersionStrings(vers))
+}
+
+func TestChartVersionsFromOCIRepositoryManifestDigest(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	reg := &fakeOCIRegistry{created: publishedVersions(5)}
+	repo := serveFakeOCIRegistry(t, reg)
+
+	// The OCI manifest digest is resolved without fetching details, but
+	// only for the versions that are returned.
+	vers, err := kihelm.ChartVersionsFromOCIRepository(
+		ctx, repo,
+		kihelm.ChartVersionsWithLimit(2),
+	)
+	require.Nil(err)
+	assert.Equal([]string{"1.0.4", "1.0.3"}, chartVersionStrings(vers))
+	assert.Len(reg.fetched, 2)
+	for _, cv := range vers {
+		manifest, _ := reg.artifact(cv.Version)
+		assert.Equal(ociDigest(manifest), cv.OCIManifestDigest)
+		assert.Empty(cv.PublishedOn)
+		assert.Empty(cv.Digest)
+	}
+}
+
+func TestChartVersionsFromOCIRepositoryMalformedCreated(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	reg := &fakeOCIRegistry{
+		created:           publishedVersions(2),
+		createdAnnotation: map[string]string{"1.0.1": "last tuesday"},
+		metadata: map[string]*helmchart.Metadata{
+			"1.0.1": {
+				Name:        "child",
+				Version:     "1.0.1",
+				AppVersion:  "1.14.0",
+				KubeVersion: ">= 1.22.0-0",
+				Deprecated:  true,
+			},
+		},
+		// Charts pushed by older helm CLI versions use the legacy chart
+		// layer media type.
+		layerMediaType: registry.LegacyChartLayerMediaType,
+	}
+	repo := serveFakeOCIRegistry(t, reg)
+	errs := &strings.Builder{}
+
+	vers, err := kihelm.ChartVersionsFromOCIRepository(
+		ctx, repo,
+		kihelm.ChartVersionsWithOCIFetchDetails(),
+		kihelm.ChartVersionsWithErrorCollector(errs),
+	)
+	require.Nil(err)
+	require.Len(vers, 2)
+	cv := vers[0]
+	assert.Equal("1.0.1", cv.Version)
+	assert.Empty(cv.PublishedOn)
+	assert.Equal("1.14.0", cv.AppVersion)
+	assert.Equal(">= 1.22.0-0", cv.KubeVersion)
+	assert.True(cv.Deprecated)
+	assert.Equal(ociDigest([]byte("chart 1.0.1")), cv.Digest)
+	assert.Contains(errs.String(), `"last tuesday"`)
+	assert.NotEmpty(vers[1].PublishedOn)
+	assert.Equal(ociDigest([]byte("chart 1.0.0")), vers[1].Digest)
+
+	// The KubeVersion constraint of the version is still honoured
+	vers, err = kihelm.ChartVersionsFromOCIRepository(
+		ctx, repo,
+		kihelm.ChartVersionsCompatibleWithKubeVersion("1.21.4"),
+	)
+	require.Nil(err)
+	assert.Equal([]string{"1.0.0"}, chartVersionStrings(vers))
+}
@@ -0,0 +1,168 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// ChartVersionsWithPrerelease returns a ChartVersionsOption that includes
+// pre-release versions (e.g. "1.2.0-rc.1") in the results of
+// LatestChartVersion() and NextChartVersions(), which skip pre-release
+// versions by default.
+func ChartVersionsWithPrerelease() ChartVersionsOption {
+	return func(o *ChartVersionsOptions) {
+		o.includePrerelease = true
+	}
+}
+
+// ChartVersionsWithDeprecated returns a ChartVersionsOption that includes
+// deprecated versions in the results of LatestChartVersion() and
+// NextChartVersions(), which skip deprecated versions by default.
+//
+// Note that deprecation information for Helm Charts published on OCI
+// repositories is only available when ChartVersionsWithOCIFetchDetails() is
+// supplied.
+func ChartVersionsWithDeprecated() ChartVersionsOption {
+	return func(o *ChartVersionsOptions) {
+		o.includeDeprecated = true
+	}
+}
+
+// LatestChartVersion returns the highest ChartVersion at the supplied
+// ChartLocation that satisfies the supplied SemVer constraint, e.g. "~1.2" or
+// ">= 1.2, < 2". An empty constraint matches any version. Deprecated and
+// pre-release versions are skipped unless ChartVersionsWithDeprecated() or
+// ChartVersionsWithPrerelease() is supplied.
+//
+// Returns nil if no version satisfies the constraint.
+func LatestChartVersion(
+	ctx context.Context,
+	loc *ChartLocation,
+	constraint string,
+	opt ...ChartVersionsOption,
+) (*ChartVersion, error) {
+	var con *semver.Constraints
+	if constraint != "" {
+		var err error
+		con, err = semver.NewConstraint(constraint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid constraint %q: %w", constraint, err)
+		}
+	}
+	vers, err := upgradeCandidates(ctx, loc, opt...)
+	if err != nil {
+		return nil, err
+	}
+	for _, cv := range vers {
+		if con == nil || checkConstraint(con, cv.SemVer) {
+			return cv, nil
+		}
+	}
+	return nil, nil
+}
+
+// NextChartVersions returns the ordered upgrade path from the supplied
+// current version to the latest ChartVersion at the supplied ChartLocation.
+// The upgrade path crosses one version boundary at a time and contains, in
+// ascending order:
+//
+//   - the highest patch version of the current minor version
+//   - the highest patch version of each later minor version of the current
+//     major version
+//   - the highest version of each later major version
+//
+// For example, with a current version of "1.2.3" and published versions
+// "1.2.4", "1.2.5", "1.3.0", "1.3.1", "1.4.0", "2.0.0", "2.1.0" and "3.0.0",
+// the upgrade path is "1.2.5", "1.3.1", "1.4.0", "2.1.0", "3.0.0".
+//
+// Deprecated and pre-release versions are skipped unless
+// ChartVersionsWithDeprecated() or ChartVersionsWithPrerelease() is supplied.
+// Returns an empty slice if the current version is the latest version.
+func NextChartVersions(
+	ctx context.Context,
+	loc *ChartLocation,
+	current string,
+	opt ...ChartVersionsOption,
+) ([]*ChartVersion, error) {
+	cur, err := semver.NewVersion(current)
+	if err != nil {
+		return nil, fmt.Errorf("invalid current version %q: %w", current, err)
+	}
+	vers, err := upgradeCandidates(ctx, loc, opt...)
+	if err != nil {
+		return nil, err
+	}
+	// boundaries is keyed by the major (and, within the current major
+	// version, minor) version of the upgrade path entry. Since vers is in
+	// descending order, the first version seen for each boundary is the
+	// highest.
+	boundaries := map[string]bool{}
+	out := []*ChartVersion{}
+	for _, cv := range vers {
+		sv := cv.SemVer
+		if !sv.GreaterThan(cur) {
+			break
+		}
+		key := fmt.Sprintf("%d", sv.Major())
+		if sv.Major() == cur.Major() {
+			key = fmt.Sprintf("%d.%d", sv.Major(), sv.Minor())
+		}
+		if boundaries[key] {
+			continue
+		}
+		boundaries[key] = true
+		out = append(out, cv)
+	}
+	slices.Reverse(out)
+	return out, nil
+}
+
+// upgradeCandidates returns the ChartVersions at the supplied ChartLocation,
+// in descending SemVer order, excluding deprecated and pre-release versions
+// unless requested.
+func upgradeCandidates(
+	ctx context.Context,
+	loc *ChartLocation,
+	opt ...ChartVersionsOption,
+) ([]*ChartVersion, error) {
+	opts := defaultChartVersionsOptions()
+	for _, o := range opt {
+		o(opts)
+	}
+	filter := func(ver *ChartVersion, _ int) bool {
+		return ver.SemVer.Prerelease() == "" || opts.includePrerelease
+	}
+	// The order must be descending so that any limit keeps the highest
+	// versions.
+	opt = append(
+		opt,
+		ChartVersionsWithFilter(filter),
+		ChartVersionsWithOrder(ChartVersionsSemverDescending),
+		func(o *ChartVersionsOptions) {
+			o.excludeDeprecated = !opts.includeDeprecated
+		},
+	)
+	return ChartVersionsFromLocation(ctx, loc, opt...)
+}
+
+// checkConstraint returns true if the supplied version satisfies the supplied
+// constraint. Unlike semver.Constraints.Check(), pre-release versions are
+// checked against the constraint using their release version, so that
+// "1.3.0-rc.1" satisfies ">= 1.2".
+func checkConstraint(con *semver.Constraints, sv *semver.Version) bool {
+	if sv.Prerelease() == "" {
+		return con.Check(sv)
+	}
+	release, err := sv.SetPrerelease("")
+	if err != nil {
+		return false
+	}
+	return con.Check(&release)
+}
@@ -0,0 +1,196 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	kihelm "github.com/jaypipes/kube-inspect/helm"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	helmrepo "helm.sh/helm/v3/pkg/repo"
+)
+
+// serveHelmRepositoryIndex starts an HTTP server serving a Helm repository
+// index file for a "child" chart with the supplied versions. Versions in the
+// supplied deprecated set are marked as deprecated. The chart archives
+// themselves are not served.
+func serveHelmRepositoryIndex(
+	t *testing.T,
+	versions []string,
+	deprecated ...string,
+) *httptest.Server {
+	require := require.New(t)
+	repoDir := t.TempDir()
+	idx := helmrepo.NewIndexFile()
+	for _, ver := range versions {
+		md := &helmchart.Metadata{
+			APIVersion: helmchart.APIVersionV2,
+			Name:       "child",
+			Version:    ver,
+			Deprecated: lo.Contains(deprecated, ver),
+		}
+		require.Nil(idx.MustAdd(md, "child-"+ver+".tgz", "", ""))
+	}
+	require.Nil(idx.WriteFile(filepath.Join(repoDir, "index.yaml"), 0o644))
+	srv := httptest.NewServer(http.FileServer(http.Dir(repoDir)))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func chartVersionStrings(vers []*kihelm.ChartVersion) []string {
+	return lo.Map(vers, func(cv *kihelm.ChartVersion, _ int) string {
+		return cv.Version
+	})
+}
+
+func TestLatestChartVersion(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+	srv := serveHelmRepositoryIndex(
+		t,
+		[]string{"1.2.3", "1.2.4", "1.3.0", "1.4.0-rc.1", "2.0.0", "2.1.0"},
+		"2.1.0",
+	)
+	loc, err := kihelm.ChartLocationFromURL(srv.URL + "/child")
+	require.Nil(err)
+
+	tcs := []struct {
+		name       string
+		constraint string
+		opts       []kihelm.ChartVersionsOption
+		exp        string
+	}{
+		{"any version skips deprecated", "", nil, "2.0.0"},
+		{
+			"any version with deprecated",
+			"",
+			[]kihelm.ChartVersionsOption{kihelm.ChartVersionsWithDeprecated()},
+			"2.1.0",
+		},
+		{"tilde constraint", "~1.2", nil, "1.2.4"},
+		{"major constraint skips pre-release", "^1", nil, "1.3.0"},
+		{
+			"major constraint with pre-release",
+			"^1",
+			[]kihelm.ChartVersionsOption{kihelm.ChartVersionsWithPrerelease()},
+			"1.4.0-rc.1",
+		},
+		{"unsatisfiable constraint", ">3", nil, ""},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+			assert := assert.New(t)
+			cv, err := kihelm.LatestChartVersion(ctx, loc, tc.constraint, tc.opts...)
+			require.Nil(err)
+			if tc.exp == "" {
+				assert.Nil(cv)
+				return
+			}
+			require.NotNil(cv)
+			assert.Equal(tc.exp, cv.Version)
+		})
+	}
+
+	_, err = kihelm.LatestChartVersion(ctx, loc, "not a constraint")
+	require.NotNil(err)
+}
+
+func TestNextChartVersions(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	srv := serveHelmRepositoryIndex(
+		t,
+		[]string{
+			"1.2.2", "1.2.3", "1.2.4", "1.2.5", "1.3.0", "1.3.1", "1.4.0",
+			"1.5.0-beta.1", "2.0.0", "2.1.0", "3.0.0", "3.1.0",
+		},
+		"3.1.0",
+	)
+	loc, err := kihelm.ChartLocationFromURL(srv.URL + "/child")
+	require.Nil(err)
+
+	vers, err := kihelm.NextChartVersions(ctx, loc, "1.2.3")
+	require.Nil(err)
+	assert.Equal(
+		[]string{"1.2.5", "1.3.1", "1.4.0", "2.1.0", "3.0.0"},
+		chartVersionStrings(vers),
+	)
+
+	vers, err = kihelm.NextChartVersions(
+		ctx, loc, "1.2.3",
+		kihelm.ChartVersionsWithPrerelease(),
+		kihelm.ChartVersionsWithDeprecated(),
+	)
+	require.Nil(err)
+	assert.Equal(
+		[]string{"1.2.5", "1.3.1", "1.4.0", "1.5.0-beta.1", "2.1.0", "3.1.0"},
+		chartVersionStrings(vers),
+	)
+
+	vers, err = kihelm.NextChartVersions(ctx, loc, "3.0.0")
+	require.Nil(err)
+	assert.Empty(vers)
+
+	_, err = kihelm.NextChartVersions(ctx, loc, "not a version")
+	require.NotNil(err)
+}
+
+func TestLatestChartVersionOCIDeprecated(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	isolateOCICredentials(t)
+	reg := &fakeOCIRegistry{
+		created: publishedVersions(3),
+		metadata: map[string]*helmchart.Metadata{
+			"1.0.2": {
+				APIVersion: helmchart.APIVersionV2,
+				Name:       "child",
+				Version:    "1.0.2",
+				Deprecated: true,
+			},
+		},
+	}
+	srv := httptest.NewServer(reg)
+	t.Cleanup(srv.Close)
+	loc, err := kihelm.ChartLocationFromURL(
+		"oci://" + strings.TrimPrefix(srv.URL, "http://") + "/charts/child",
+	)
+	require.Nil(err)
+	plainHTTP := kihelm.ChartVersionsWithOCIOptions(kihelm.OCIWithPlainHTTP())
+	details := kihelm.ChartVersionsWithOCIFetchDetails()
+
+	cv, err := kihelm.LatestChartVersion(ctx, loc, "", plainHTTP, details)
+	require.Nil(err)
+	require.NotNil(cv)
+	assert.Equal("1.0.1", cv.Version)
+
+	cv, err = kihelm.LatestChartVersion(
+		ctx, loc, "", plainHTTP, details, kihelm.ChartVersionsWithDeprecated(),
+	)
+	require.Nil(err)
+	require.NotNil(cv)
+	assert.Equal("1.0.2", cv.Version)
+
+	// Without details, deprecation information is not available
+	cv, err = kihelm.LatestChartVersion(ctx, loc, "", plainHTTP)
+	require.Nil(err)
+	require.NotNil(cv)
+	assert.Equal("1.0.2", cv.Version)
+
+	vers, err := kihelm.NextChartVersions(ctx, loc, "1.0.0", plainHTTP, details)
+	require.Nil(err)
+	assert.Equal([]string{"1.0.1"}, chartVersionStrings(vers))
+}
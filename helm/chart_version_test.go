@@ -7,14 +7,20 @@ package helm_test
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/jaypipes/kube-inspect/helm"
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	helmrepo "helm.sh/helm/v3/pkg/repo"
 )
 
 func TestChartVersionsFromLocation(t *testing.T) {
@@ -138,3 +144,182 @@ func TestChartVersionsFromLocation(t *testing.T) {
 		})
 	}
 }
+
+func TestChartVersionsOrder(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+	// Publish versions out of SemVer order, as happens when patch releases
+	// are made for older minor versions.
+	published := []struct {
+		version string
+		created time.Time
+	}{
+		{"1.0.0", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"1.1.0", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"2.0.0", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"1.1.1", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"1.10.0", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	repoDir := t.TempDir()
+	idx := helmrepo.NewIndexFile()
+	for _, p := range published {
+		md := &helmchart.Metadata{
+			APIVersion: helmchart.APIVersionV2,
+			Name:       "child",
+			Version:    p.version,
+		}
+		require.Nil(idx.MustAdd(md, "child-"+p.version+".tgz", "", ""))
+		cv, err := idx.Get("child", p.version)
+		require.Nil(err)
+		cv.Created = p.created
+	}
+	require.Nil(idx.WriteFile(filepath.Join(repoDir, "index.yaml"), 0o644))
+	srv := httptest.NewServer(http.FileServer(http.Dir(repoDir)))
+	t.Cleanup(srv.Close)
+	loc, err := helm.ChartLocationFromURL(srv.URL + "/child")
+	require.Nil(err)
+
+	tcs := []struct {
+		name  string
+		order *helm.ChartVersionsOrder
+		limit int
+		exp   []string
+	}{
+		{
+			"default semver descending",
+			nil,
+			0,
+			[]string{"2.0.0", "1.10.0", "1.1.1", "1.1.0", "1.0.0"},
+		},
+		{
+			"semver ascending",
+			lo.ToPtr(helm.ChartVersionsSemverAscending),
+			0,
+			[]string{"1.0.0", "1.1.0", "1.1.1", "1.10.0", "2.0.0"},
+		},
+		{
+			"published descending",
+			lo.ToPtr(helm.ChartVersionsPublishedDescending),
+			0,
+			[]string{"1.10.0", "1.1.1", "2.0.0", "1.1.0", "1.0.0"},
+		},
+		{
+			"published ascending",
+			lo.ToPtr(helm.ChartVersionsPublishedAscending),
+			0,
+			[]string{"1.0.0", "1.1.0", "2.0.0", "1.1.1", "1.10.0"},
+		},
+		{
+			"limit applied after semver order",
+			nil,
+			2,
+			[]string{"2.0.0", "1.10.0"},
+		},
+		{
+			"limit applied after published order",
+			lo.ToPtr(helm.ChartVersionsPublishedDescending),
+			2,
+			[]string{"1.10.0", "1.1.1"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(tt *testing.T) {
+			assert := assert.New(tt)
+			require := require.New(tt)
+			opts := []helm.ChartVersionsOption{}
+			if tc.order != nil {
+				opts = append(opts, helm.ChartVersionsWithOrder(*tc.order))
+			}
+			if tc.limit > 0 {
+				opts = append(opts, helm.ChartVersionsWithLimit(tc.limit))
+			}
+			got, err := helm.ChartVersionsFromLocation(ctx, loc, opts...)
+			require.Nil(err)
+			vers := lo.Map(got, func(cv *helm.ChartVersion, _ int) string {
+				return cv.Version
+			})
+			assert.Equal(tc.exp, vers)
+			for _, cv := range got {
+				require.NotNil(cv.SemVer)
+				assert.Equal(cv.Version, cv.SemVer.String())
+			}
+		})
+	}
+}
+
+func TestChartVersionsMetadata(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	repoDir := t.TempDir()
+	idx := helmrepo.NewIndexFile()
+	for _, md := range []*helmchart.Metadata{
+		{
+			Version:     "1.0.0",
+			AppVersion:  "1.13.0",
+			KubeVersion: ">= 1.20.0-0, < 1.25.0-0",
+		},
+		{
+			Version:     "1.1.0",
+			AppVersion:  "1.14.0",
+			Description: "A child chart",
+			KubeVersion: ">= 1.22.0-0",
+		},
+		{
+			Version:    "1.2.0",
+			AppVersion: "1.14.1",
+		},
+	} {
+		md.APIVersion = helmchart.APIVersionV2
+		md.Name = "child"
+		require.Nil(idx.MustAdd(
+			md, "child-"+md.Version+".tgz", "", "1a2b3c"+md.Version,
+		))
+	}
+	require.Nil(idx.WriteFile(filepath.Join(repoDir, "index.yaml"), 0o644))
+	srv := httptest.NewServer(http.FileServer(http.Dir(repoDir)))
+	t.Cleanup(srv.Close)
+	loc, err := helm.ChartLocationFromURL(srv.URL + "/child")
+	require.Nil(err)
+
+	vers, err := helm.ChartVersionsFromLocation(ctx, loc)
+	require.Nil(err)
+	require.Len(vers, 3)
+	cv := vers[1]
+	assert.Equal("1.1.0", cv.Version)
+	assert.Equal("1.14.0", cv.AppVersion)
+	assert.Equal("A child chart", cv.Description)
+	assert.Equal(">= 1.22.0-0", cv.KubeVersion)
+	assert.Equal("sha256:1a2b3c1.1.0", cv.Digest)
+	assert.Equal([]string{srv.URL + "/child-1.1.0.tgz"}, cv.URLs)
+
+	tcs := []struct {
+		kubeVersion string
+		exp         []string
+	}{
+		{"1.21.4", []string{"1.2.0", "1.0.0"}},
+		{"1.24.0", []string{"1.2.0", "1.1.0", "1.0.0"}},
+		{"1.29.3-gke.1093000", []string{"1.2.0", "1.1.0"}},
+		{"v1.19", []string{"1.2.0"}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.kubeVersion, func(tt *testing.T) {
+			assert := assert.New(tt)
+			require := require.New(tt)
+			vers, err := helm.ChartVersionsFromLocation(
+				ctx, loc,
+				helm.ChartVersionsCompatibleWithKubeVersion(tc.kubeVersion),
+			)
+			require.Nil(err)
+			got := lo.Map(vers, func(cv *helm.ChartVersion, _ int) string {
+				return cv.Version
+			})
+			assert.Equal(tc.exp, got)
+		})
+	}
+
+	_, err = helm.ChartVersionsFromLocation(
+		ctx, loc, helm.ChartVersionsCompatibleWithKubeVersion("not a version"),
+	)
+	require.NotNil(err)
+}
@@ -0,0 +1,164 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	helmchartutil "helm.sh/helm/v3/pkg/chartutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/jaypipes/kube-inspect/debug"
+)
+
+// Dependency describes a subchart that the Helm Chart depends on.
+type Dependency struct {
+	// Name is the name of the subchart.
+	Name string
+	// Alias is the alias for the subchart, if any. When a subchart has an
+	// alias, its values are keyed by the alias instead of the name.
+	Alias string
+	// Version is the version constraint for the subchart, e.g. "1.x.x".
+	Version string
+	// Repository is the repository URL for the subchart.
+	Repository string
+	// Condition is the comma-separated list of values paths that control
+	// whether the subchart is enabled, e.g. "postgresql.enabled".
+	Condition string
+	// Tags contains the tags that control whether the subchart is enabled.
+	Tags []string
+	// Enabled is true when the subchart is enabled with the values used to
+	// inspect the Helm Chart.
+	Enabled bool
+	// Chart is the subchart, or nil if the subchart is not present in the
+	// Helm Chart's charts/ directory.
+	Chart *helmchart.Chart
+	// Resources contains the Kubernetes resources rendered by the subchart's
+	// templates (including the templates of any subcharts of the subchart).
+	Resources []*unstructured.Unstructured
+}
+
+// ValuesKey returns the key of the subchart's values in the parent Helm
+// Chart's values, which is the alias of the subchart if it has one or the name
+// of the subchart otherwise.
+func (d *Dependency) ValuesKey() string {
+	if d.Alias != "" {
+		return d.Alias
+	}
+	return d.Name
+}
+
+// Dependencies returns a slice of Dependency structs describing the subcharts
+// that the Helm Chart depends on, in the order they are declared in the Helm
+// Chart's metadata.
+//
+// NOTE: this method shadows the helm sdk-go `Chart.Dependencies()` method.
+// Use `Chart.Chart.Dependencies()` to get the subchart `*Chart` structs.
+func (c *Chart) Dependencies(
+	ctx context.Context,
+) ([]*Dependency, error) {
+	hc := c.Chart
+	if hc == nil {
+		return nil, fmt.Errorf("cannot get dependencies for nil chart.")
+	}
+	ctx = debug.PushTrace(ctx, "helm:chart:dependencies")
+	defer debug.PopTrace(ctx)
+	res := []*Dependency{}
+	if hc.Metadata == nil || len(hc.Metadata.Dependencies) == 0 {
+		return res, nil
+	}
+	vals, err := helmchartutil.CoalesceValues(hc, c.inspectOpts.values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to coalesce values: %w", err)
+	}
+	if !c.rendered {
+		if err := c.render(ctx); err != nil {
+			return nil, err
+		}
+	}
+	sourced, err := sourcedResourcesFromManifest(ctx, c.manifest.String())
+	if err != nil {
+		return nil, err
+	}
+	for _, md := range hc.Metadata.Dependencies {
+		d := &Dependency{
+			Name:       md.Name,
+			Alias:      md.Alias,
+			Version:    md.Version,
+			Repository: md.Repository,
+			Condition:  md.Condition,
+			Tags:       md.Tags,
+			Enabled:    dependencyEnabled(md, vals),
+			Resources:  []*unstructured.Unstructured{},
+		}
+		for _, sc := range hc.Dependencies() {
+			if sc.Name() == md.Name {
+				d.Chart = sc
+				break
+			}
+		}
+		// Subchart templates are rendered with a path of
+		// <parent>/charts/<alias or name>/...
+		prefix := fmt.Sprintf("%s/charts/%s/", hc.Name(), d.ValuesKey())
+		for _, sr := range sourced {
+			if strings.HasPrefix(sr.source, prefix) {
+				d.Resources = append(d.Resources, sr.resource)
+			}
+		}
+		debug.Printf(
+			ctx, "dependency %s (enabled: %t) contributes %d resources\n",
+			d.ValuesKey(), d.Enabled, len(d.Resources),
+		)
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+// dependencyEnabled returns whether the supplied dependency is enabled using
+// the supplied (coalesced) values. This follows the same logic as Helm: tags
+// are evaluated first and then the first condition path that resolves to a
+// boolean value overrides the result of the tags.
+//
+// See: https://github.com/helm/helm/blob/v3.19.0/pkg/chartutil/dependencies.go
+func dependencyEnabled(
+	dep *helmchart.Dependency,
+	vals helmchartutil.Values,
+) bool {
+	enabled := true
+	if len(dep.Tags) > 0 {
+		tags, _ := vals.Table("tags")
+		hasTrue, hasFalse := false, false
+		for _, tag := range dep.Tags {
+			if b, ok := tags[tag].(bool); ok {
+				if b {
+					hasTrue = true
+				} else {
+					hasFalse = true
+				}
+			}
+		}
+		if !hasTrue && hasFalse {
+			enabled = false
+		}
+	}
+	for _, cond := range strings.Split(dep.Condition, ",") {
+		cond = strings.TrimSpace(cond)
+		if cond == "" {
+			continue
+		}
+		v, err := vals.PathValue(cond)
+		if err != nil {
+			continue
+		}
+		if b, ok := v.(bool); ok {
+			enabled = b
+			break
+		}
+	}
+	return enabled
+}
@@ -0,0 +1,286 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/registry"
+	helmrepo "helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+
+	"github.com/jaypipes/kube-inspect/debug"
+)
+
+// WithDependencyResolution instructs Inspect to resolve and fetch any of the
+// Helm Chart's dependencies that are not present in the Helm Chart's charts/
+// directory. Dependency versions are taken from the Helm Chart's Chart.lock
+// file when present, otherwise the version constraints in the Helm Chart's
+// metadata are resolved against the dependency's Helm or OCI repository.
+//
+// Fetched dependencies are stored in the chart cache, if enabled with
+// WithCacheDir(), and are reused by subsequent inspections.
+//
+// Dependencies whose repository is a Helm repository alias, e.g. "@stable",
+// are not supported, nor are relative `file://` repositories of Helm Charts
+// that are not inspected from an unpacked Helm Chart directory.
+func WithDependencyResolution() InspectOption {
+	return func(opts *InspectOptions) {
+		opts.resolveDependencies = true
+	}
+}
+
+// WithOffline instructs Inspect to use only the chart cache (see
+// WithCacheDir()), never fetching Helm Chart archives, OCI artifacts or Helm
+// repository index files from a Helm or OCI repository. Cached entries are
+// used regardless of WithCacheTTL(). Inspect fails if anything it needs,
+// including a dependency being resolved, is not present in the chart cache.
+//
+// Because listing the tags in an OCI repository requires the OCI registry,
+// dependencies on Helm Charts in OCI repositories can only be resolved
+// offline at an exact version, e.g. from the Helm Chart's Chart.lock file.
+func WithOffline() InspectOption {
+	return func(opts *InspectOptions) {
+		opts.offline = true
+	}
+}
+
+// resolveDependencies fetches any of the supplied Helm Chart's dependencies
+// that are not present in the Helm Chart's charts/ directory and returns a
+// copy of the Helm Chart with the fetched dependencies added. The supplied
+// Helm Chart is not modified.
+//
+// The chartDir argument is the directory containing the Helm Chart, if known,
+// and is used to resolve `file://` repository references.
+func resolveDependencies(
+	ctx context.Context,
+	hc *helmchart.Chart,
+	chartDir string,
+	opts *InspectOptions,
+) (*helmchart.Chart, error) {
+	if hc.Metadata == nil || len(hc.Metadata.Dependencies) == 0 {
+		return hc, nil
+	}
+	ctx = debug.PushTrace(ctx, "helm:resolve-dependencies")
+	defer debug.PopTrace(ctx)
+	hc = copyChart(hc)
+	for _, dep := range hc.Metadata.Dependencies {
+		if hasDependency(hc, dep) {
+			continue
+		}
+		version := dep.Version
+		if hc.Lock != nil {
+			// Charts with the same name may be depended on from different
+			// repositories.
+			for _, locked := range hc.Lock.Dependencies {
+				if locked.Name == dep.Name &&
+					locked.Repository == dep.Repository {
+					version = locked.Version
+					break
+				}
+			}
+		}
+		debug.Printf(
+			ctx, "resolving dependency %s (version %s) from %s\n",
+			dep.Name, version, dep.Repository,
+		)
+		sc, err := fetchDependency(ctx, dep, version, chartDir, opts)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to resolve dependency %q: %w", dep.Name, err,
+			)
+		}
+		hc.AddDependency(sc)
+	}
+	return hc, nil
+}
+
+// hasDependency returns true if the supplied Helm Chart has a loaded subchart
+// for the supplied dependency. Subcharts are usually loaded with the
+// dependency's chart name, but have the dependency's alias, if any, once helm
+// has processed the Helm Chart's dependencies.
+func hasDependency(hc *helmchart.Chart, dep *helmchart.Dependency) bool {
+	for _, sc := range hc.Dependencies() {
+		if sc.Name() == dep.Name ||
+			(dep.Alias != "" && sc.Name() == dep.Alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchDependency returns the subchart for the supplied dependency and
+// version (which may be a version constraint), fetching it from the
+// dependency's repository or the chart cache.
+func fetchDependency(
+	ctx context.Context,
+	dep *helmchart.Dependency,
+	version string,
+	chartDir string,
+	opts *InspectOptions,
+) (*helmchart.Chart, error) {
+	if after, ok := strings.CutPrefix(dep.Repository, "file://"); ok {
+		path := after
+		if !filepath.IsAbs(path) {
+			// Only unpacked Helm Charts have a directory that relative
+			// paths can be resolved against.
+			if chartDir == "" {
+				return nil, fmt.Errorf(
+					"cannot resolve relative repository %q without a "+
+						"chart directory",
+					dep.Repository,
+				)
+			}
+			path = filepath.Join(chartDir, path)
+		}
+		return loader.Load(path)
+	}
+	// Like `helm dependency build`, the helm CLI resolves repository
+	// aliases, e.g. "@stable" or "alias:stable", with its repository
+	// configuration.
+	if strings.HasPrefix(dep.Repository, "@") ||
+		strings.HasPrefix(dep.Repository, "alias:") {
+		return nil, fmt.Errorf(
+			"repository aliases not supported: %q", dep.Repository,
+		)
+	}
+	var lc *loadedChart
+	var err error
+	if registry.IsOCI(dep.Repository) {
+		lc, err = fetchOCIDependency(ctx, dep, version, opts)
+	} else {
+		lc, err = fetchHelmRepositoryChart(
+			ctx, dep.Repository, dep.Name, version, &opts.http, opts,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lc.chart, nil
+}
+
+// fetchOCIDependency pulls the highest version of the supplied dependency
+// that satisfies the supplied version constraint from the dependency's OCI
+// repository.
+func fetchOCIDependency(
+	ctx context.Context,
+	dep *helmchart.Dependency,
+	version string,
+	opts *InspectOptions,
+) (*loadedChart, error) {
+	ref := strings.TrimSuffix(dep.Repository, "/") + "/" + dep.Name
+	if opts.offline {
+		if _, err := semver.NewVersion(version); err != nil {
+			return nil, fmt.Errorf(
+				"cannot resolve version constraint %q for %s offline",
+				version, ref,
+			)
+		}
+		return loadOCI(ctx, ref, version, opts)
+	}
+	con, err := semver.NewConstraint(version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version %q: %w", version, err)
+	}
+	loc, err := ChartLocationFromURL(ref)
+	if err != nil {
+		return nil, err
+	}
+	vers, err := ChartVersionsFromLocation(
+		ctx, loc,
+		ChartVersionsMatchingConstraint(*con),
+		ChartVersionsWithOCIOptions(opts.oci...),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var best *semver.Version
+	for _, cv := range vers {
+		sv, err := semver.NewVersion(cv.Version)
+		if err != nil {
+			continue
+		}
+		if best == nil || sv.GreaterThan(best) {
+			best = sv
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf(
+			"no version of %s satisfies constraint %q", ref, con.String(),
+		)
+	}
+	return loadOCI(ctx, ref, best.Original(), opts)
+}
+
+// fetchHelmRepositoryChart downloads the highest version of the named chart
+// that satisfies the supplied version (constraint) from the Helm repository at
+// the supplied URL using the supplied httpOptions. If a keyring was supplied
+// with WithKeyring(), the chart is verified against the keyring.
+func fetchHelmRepositoryChart(
+	ctx context.Context,
+	repoURL string,
+	name string,
+	version string,
+	httpOpts *httpOptions,
+	opts *InspectOptions,
+) (*loadedChart, error) {
+	idx, err := fetchIndexFile(ctx, repoURL, httpOpts, opts.chartCache())
+	if err != nil {
+		return nil, err
+	}
+	cv, err := idx.Get(name, version)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"chart %s (version %s) not found in %s: %w",
+			name, version, repoURL, err,
+		)
+	}
+	if len(cv.URLs) == 0 {
+		return nil, fmt.Errorf(
+			"chart %s (version %s) in %s has no URLs",
+			name, cv.Version, repoURL,
+		)
+	}
+	// URLs in index.yaml files may be relative to the repository URL.
+	archiveURL, err := helmrepo.ResolveReferenceURL(repoURL, cv.URLs[0])
+	if err != nil {
+		return nil, err
+	}
+	// Like the helm CLI, only send credentials to the Helm repository's host.
+	return loadArchiveURL(
+		ctx, archiveURL, cv.Digest,
+		httpOpts.forRepository(repoURL, archiveURL), opts,
+	)
+}
+
+// fetchIndexFile downloads and parses the index.yaml file for the Helm
+// repository at the supplied URL, using the supplied chart cache (which may be
+// nil) if enabled.
+func fetchIndexFile(
+	ctx context.Context,
+	repoURL string,
+	httpOpts *httpOptions,
+	cache *chartCache,
+) (*helmrepo.IndexFile, error) {
+	ctx = debug.PushTrace(ctx, "helm:fetch-index-file")
+	defer debug.PopTrace(ctx)
+	indexURL := strings.TrimSuffix(repoURL, "/") + "/index.yaml"
+	b, err := fetchCached(ctx, indexURL, httpOpts, cache)
+	if err != nil {
+		return nil, err
+	}
+	idx := &helmrepo.IndexFile{}
+	if err := yaml.Unmarshal(b, idx); err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", indexURL, err)
+	}
+	idx.SortEntries()
+	return idx, nil
+}
@@ -0,0 +1,298 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	kihelm "github.com/jaypipes/kube-inspect/helm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	helmchartutil "helm.sh/helm/v3/pkg/chartutil"
+	helmrepo "helm.sh/helm/v3/pkg/repo"
+)
+
+const childConfigMapTemplate = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-{{ .Chart.Name }}
+data:
+  version: {{ .Chart.Version | quote }}
+`
+
+// serveHelmRepository starts an HTTP server serving a Helm repository that
+// contains the supplied versions of a "child" chart.
+func serveHelmRepository(t *testing.T, versions ...string) *httptest.Server {
+	repoDir := writeHelmRepository(t, versions...)
+	srv := httptest.NewServer(http.FileServer(http.Dir(repoDir)))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// writeHelmRepository returns a directory containing a Helm repository with
+// the supplied versions of a "child" chart, using relative URLs in the
+// index.yaml file.
+func writeHelmRepository(t *testing.T, versions ...string) string {
+	require := require.New(t)
+	repoDir := t.TempDir()
+	idx := helmrepo.NewIndexFile()
+	for _, ver := range versions {
+		child := &helmchart.Chart{
+			Metadata: &helmchart.Metadata{
+				APIVersion: helmchart.APIVersionV2,
+				Name:       "child",
+				Version:    ver,
+			},
+			Templates: []*helmchart.File{
+				{
+					Name: "templates/configmap.yaml",
+					Data: []byte(childConfigMapTemplate),
+				},
+			},
+		}
+		path, err := helmchartutil.Save(child, repoDir)
+		require.Nil(err)
+		require.Nil(idx.MustAdd(child.Metadata, filepath.Base(path), "", ""))
+	}
+	require.Nil(idx.WriteFile(filepath.Join(repoDir, "index.yaml"), 0o644))
+	return repoDir
+}
+
+// umbrellaChart returns a Helm Chart with a single dependency on the "child"
+// chart in the supplied Helm repository and an empty charts/ directory.
+func umbrellaChart(repoURL string, version string) *helmchart.Chart {
+	return &helmchart.Chart{
+		Metadata: &helmchart.Metadata{
+			APIVersion: helmchart.APIVersionV2,
+			Name:       "parent",
+			Version:    "0.1.0",
+			Dependencies: []*helmchart.Dependency{
+				{
+					Name:       "child",
+					Version:    version,
+					Repository: repoURL,
+				},
+			},
+		},
+	}
+}
+
+func TestInspectWithDependencyResolution(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	srv := serveHelmRepository(t, "0.1.0", "0.2.0")
+
+	c, err := kihelm.Inspect(
+		ctx, umbrellaChart(srv.URL, ">=0.1.0"),
+		kihelm.WithDependencyResolution(),
+	)
+	require.Nil(err)
+	resources, err := c.Resources(ctx)
+	require.Nil(err)
+	require.Len(resources, 1)
+	assert.Equal("kube-inspect-child", resources[0].GetName())
+	assert.Equal("0.2.0", resources[0].Object["data"].(map[string]any)["version"])
+
+	// The Chart.lock version takes precedence over the version constraint
+	hc := umbrellaChart(srv.URL, ">=0.1.0")
+	hc.Lock = &helmchart.Lock{
+		Dependencies: []*helmchart.Dependency{
+			{Name: "child", Version: "0.1.0", Repository: srv.URL},
+		},
+	}
+	c, err = kihelm.Inspect(ctx, hc, kihelm.WithDependencyResolution())
+	require.Nil(err)
+	resources, err = c.Resources(ctx)
+	require.Nil(err)
+	require.Len(resources, 1)
+	assert.Equal("0.1.0", resources[0].Object["data"].(map[string]any)["version"])
+
+	// Only the Chart.lock entry for the dependency's repository is used
+	hc.Lock = &helmchart.Lock{
+		Dependencies: []*helmchart.Dependency{
+			{
+				Name:       "child",
+				Version:    "0.1.0",
+				Repository: "https://charts.example.com",
+			},
+			{Name: "child", Version: "0.2.0", Repository: srv.URL},
+		},
+	}
+	c, err = kihelm.Inspect(ctx, hc, kihelm.WithDependencyResolution())
+	require.Nil(err)
+	resources, err = c.Resources(ctx)
+	require.Nil(err)
+	require.Len(resources, 1)
+	assert.Equal("0.2.0", resources[0].Object["data"].(map[string]any)["version"])
+
+	// The supplied Helm Chart is not modified, so inspecting it again resolves
+	// its dependencies again
+	assert.Empty(hc.Dependencies())
+	hc.Lock = nil
+	c, err = kihelm.Inspect(ctx, hc, kihelm.WithDependencyResolution())
+	require.Nil(err)
+	resources, err = c.Resources(ctx)
+	require.Nil(err)
+	require.Len(resources, 1)
+	assert.Equal("0.2.0", resources[0].Object["data"].(map[string]any)["version"])
+}
+
+func TestInspectWithDependencyResolutionUnsupportedRepository(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+
+	// A Helm Chart that is not inspected from a directory has nothing to
+	// resolve a relative path against.
+	_, err := kihelm.Inspect(
+		ctx, umbrellaChart("file://../child", "0.1.0"),
+		kihelm.WithDependencyResolution(),
+	)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "without a chart directory")
+
+	for _, repoURL := range []string{"@stable", "alias:stable"} {
+		_, err = kihelm.Inspect(
+			ctx, umbrellaChart(repoURL, "0.1.0"),
+			kihelm.WithDependencyResolution(),
+		)
+		require.NotNil(err)
+		assert.Contains(err.Error(), "repository aliases not supported")
+	}
+}
+
+func TestInspectWithDependencyResolutionAlias(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	// A subchart loaded with the dependency's alias is not fetched again. The
+	// repository alias would fail to resolve if it were.
+	hc := umbrellaChart("@stable", "0.1.0")
+	hc.Metadata.Dependencies[0].Alias = "renamed"
+	hc.AddDependency(&helmchart.Chart{
+		Metadata: &helmchart.Metadata{
+			APIVersion: helmchart.APIVersionV2,
+			Name:       "renamed",
+			Version:    "0.1.0",
+		},
+	})
+	_, err := kihelm.Inspect(ctx, hc, kihelm.WithDependencyResolution())
+	require.Nil(err)
+}
+
+func TestInspectWithDependencyResolutionOffline(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	srv := serveHelmRepository(t, "0.1.0")
+	cacheDir := t.TempDir()
+
+	// The chart cache is required
+	_, err := kihelm.Inspect(
+		ctx, umbrellaChart(srv.URL, "0.1.0"),
+		kihelm.WithDependencyResolution(),
+		kihelm.WithOffline(),
+	)
+	require.NotNil(err)
+	assert.ErrorContains(err, "requires WithCacheDir()")
+
+	// Nothing in the cache yet
+	_, err = kihelm.Inspect(
+		ctx, umbrellaChart(srv.URL, "0.1.0"),
+		kihelm.WithDependencyResolution(),
+		kihelm.WithCacheDir(cacheDir),
+		kihelm.WithOffline(),
+	)
+	require.NotNil(err)
+	assert.ErrorContains(err, "not found in chart cache")
+
+	// Warm the cache, then shut down the repository
+	_, err = kihelm.Inspect(
+		ctx, umbrellaChart(srv.URL, "0.1.0"),
+		kihelm.WithDependencyResolution(),
+		kihelm.WithCacheDir(cacheDir),
+	)
+	require.Nil(err)
+	srv.Close()
+
+	// Cached entries are used offline even once they have expired
+	c, err := kihelm.Inspect(
+		ctx, umbrellaChart(srv.URL, "0.1.0"),
+		kihelm.WithDependencyResolution(),
+		kihelm.WithCacheDir(cacheDir),
+		kihelm.WithCacheTTL(time.Nanosecond),
+		kihelm.WithOffline(),
+	)
+	require.Nil(err)
+	resources, err := c.Resources(ctx)
+	require.Nil(err)
+	require.Len(resources, 1)
+	assert.Equal("kube-inspect-child", resources[0].GetName())
+
+	// A dependency in a different Helm repository is not served from the
+	// cache
+	_, err = kihelm.Inspect(
+		ctx, umbrellaChart(srv.URL+"/other", "0.1.0"),
+		kihelm.WithDependencyResolution(),
+		kihelm.WithCacheDir(cacheDir),
+		kihelm.WithOffline(),
+	)
+	require.NotNil(err)
+	assert.ErrorContains(err, "not found in chart cache")
+}
+
+func TestInspectWithOCIDependencyResolutionOffline(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	isolateOCICredentials(t)
+	reg, _ := childChartRegistry(t)
+	srv := httptest.NewServer(reg)
+	t.Cleanup(srv.Close)
+	repoURL := "oci://" + strings.TrimPrefix(srv.URL, "http://") + "/charts"
+	cacheDir := t.TempDir()
+	plainHTTP := kihelm.WithOCIOptions(kihelm.OCIWithPlainHTTP())
+
+	_, err := kihelm.Inspect(
+		ctx, umbrellaChart(repoURL, "1.0.1"),
+		kihelm.WithDependencyResolution(),
+		kihelm.WithCacheDir(cacheDir),
+		plainHTTP,
+	)
+	require.Nil(err)
+	srv.Close()
+
+	c, err := kihelm.Inspect(
+		ctx, umbrellaChart(repoURL, "1.0.1"),
+		kihelm.WithDependencyResolution(),
+		kihelm.WithCacheDir(cacheDir),
+		kihelm.WithOffline(),
+		plainHTTP,
+	)
+	require.Nil(err)
+	resources, err := c.Resources(ctx)
+	require.Nil(err)
+	require.Len(resources, 1)
+
+	// Resolving a version constraint requires listing the OCI repository's
+	// tags
+	_, err = kihelm.Inspect(
+		ctx, umbrellaChart(repoURL, ">=1.0.0"),
+		kihelm.WithDependencyResolution(),
+		kihelm.WithCacheDir(cacheDir),
+		kihelm.WithOffline(),
+		plainHTTP,
+	)
+	require.NotNil(err)
+	assert.ErrorContains(err, "offline")
+}
@@ -0,0 +1,92 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	kihelm "github.com/jaypipes/kube-inspect/helm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	umbrellaLocalChartDir = filepath.Join("testdata", "umbrella")
+)
+
+func TestDependencies(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	c, err := kihelm.Inspect(ctx, umbrellaLocalChartDir)
+	require.Nil(err)
+
+	deps, err := c.Dependencies(ctx)
+	require.Nil(err)
+	require.Len(deps, 2)
+
+	child := deps[0]
+	assert.Equal("child", child.Name)
+	assert.Equal("", child.Alias)
+	assert.Equal("0.1.0", child.Version)
+	assert.Equal("child.enabled", child.Condition)
+	assert.True(child.Enabled)
+	require.NotNil(child.Chart)
+	require.Len(child.Resources, 1)
+	assert.Equal("kube-inspect-child", child.Resources[0].GetName())
+
+	sidekick := deps[1]
+	assert.Equal("child", sidekick.Name)
+	assert.Equal("sidekick", sidekick.Alias)
+	assert.Equal("~0.1", sidekick.Version)
+	assert.Equal([]string{"sidekicks"}, sidekick.Tags)
+	assert.False(sidekick.Enabled)
+	assert.Empty(sidekick.Resources)
+
+	// The parent chart's resources include the enabled subchart's resources
+	resources, err := c.Resources(ctx)
+	require.Nil(err)
+	assert.Len(resources, 2)
+}
+
+func TestDependenciesEnabledByValues(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	c, err := kihelm.Inspect(
+		ctx, umbrellaLocalChartDir,
+		kihelm.WithValues("child.enabled=false,sidekick.enabled=true"),
+	)
+	require.Nil(err)
+
+	deps, err := c.Dependencies(ctx)
+	require.Nil(err)
+	require.Len(deps, 2)
+	assert.False(deps[0].Enabled)
+	assert.Empty(deps[0].Resources)
+	assert.True(deps[1].Enabled)
+	require.Len(deps[1].Resources, 1)
+	assert.Equal("kube-inspect-sidekick", deps[1].Resources[0].GetName())
+}
+
+func TestDependenciesLibraryChart(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	c, err := kihelm.Inspect(ctx, nginxLocalChartDir)
+	require.Nil(err)
+
+	deps, err := c.Dependencies(ctx)
+	require.Nil(err)
+	require.Len(deps, 1)
+	assert.Equal("common", deps[0].Name)
+	assert.Equal("1.x.x", deps[0].Version)
+	assert.Equal([]string{"bitnami-common"}, deps[0].Tags)
+	assert.True(deps[0].Enabled)
+	// common is a library chart, so it does not render any resources itself
+	assert.Empty(deps[0].Resources)
+}
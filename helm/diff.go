@@ -7,10 +7,12 @@ package helm
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/jaypipes/kube-inspect/diff"
 	"github.com/jaypipes/kube-inspect/kube"
 	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 type ChartDiff struct {
@@ -77,5 +79,28 @@ func resourcesDiff(
 	if err != nil {
 		return nil, err
 	}
-	return kube.DiffResources(ars, brs)
+	return kube.DiffResources(
+		trimReleaseNamePrefix(ars, a.inspectOpts.releaseName),
+		trimReleaseNamePrefix(brs, b.inspectOpts.releaseName),
+	)
+}
+
+// trimReleaseNamePrefix returns copies of the supplied resources with the
+// "<release name>-" prefix that most Helm Charts tack on to the names of the
+// resources they render stripped. This allows resources from Charts rendered
+// with different release names to be compared with each other. The supplied
+// resources are not modified.
+func trimReleaseNamePrefix(
+	rs []*unstructured.Unstructured,
+	releaseName string,
+) []*unstructured.Unstructured {
+	out := make([]*unstructured.Unstructured, 0, len(rs))
+	for _, r := range rs {
+		r = r.DeepCopy()
+		if after, ok := strings.CutPrefix(r.GetName(), releaseName+"-"); ok {
+			r.SetName(after)
+		}
+		out = append(out, r)
+	}
+	return out
 }
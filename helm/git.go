@@ -0,0 +1,311 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	"sigs.k8s.io/yaml"
+
+	"github.com/jaypipes/kube-inspect/debug"
+)
+
+// gitRepository is a temporary clone of a Git repository containing a Helm
+// Chart. Git operations are performed using the `git` executable, so that any
+// credential helpers and SSH configuration of the user are used.
+type gitRepository struct {
+	// url is the URL of the Git repository.
+	url string
+	// dir is the directory containing the clone.
+	dir string
+	// chartPath is the path to the Helm Chart within the Git repository.
+	chartPath string
+}
+
+// gitTag is a tag in a Git repository.
+type gitTag struct {
+	name string
+	// created is the date the tag (or, for lightweight tags, the tagged
+	// commit) was created.
+	created time.Time
+}
+
+// cloneGitRepository clones the Git repository at the supplied URL into a
+// temporary directory, without checking out a working tree. The caller must
+// call close() on the returned gitRepository.
+func cloneGitRepository(
+	ctx context.Context,
+	url string,
+	chartPath string,
+) (*gitRepository, error) {
+	ctx = debug.PushTrace(ctx, "helm:git-clone")
+	defer debug.PopTrace(ctx)
+	chartPath, err := cleanGitChartPath(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "kube-inspect-git")
+	if err != nil {
+		return nil, err
+	}
+	r := &gitRepository{url: url, dir: dir, chartPath: chartPath}
+	if _, err := r.git(
+		ctx, "clone", "--quiet", "--no-checkout", "--", url, dir,
+	); err != nil {
+		r.close()
+		return nil, fmt.Errorf("failed to clone %s: %w", url, err)
+	}
+	debug.Printf(ctx, "cloned %s into %s\n", url, dir)
+	return r, nil
+}
+
+// cleanGitChartPath returns the supplied path to a Helm Chart within a Git
+// repository in its shortest form, or an error if the path is absolute or
+// refers to anything outside the Git repository.
+func cleanGitChartPath(chartPath string) (string, error) {
+	cleaned := path.Clean(filepath.ToSlash(chartPath))
+	if path.IsAbs(cleaned) || filepath.IsAbs(chartPath) ||
+		cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf(
+			"chart path %q is outside the Git repository", chartPath,
+		)
+	}
+	return cleaned, nil
+}
+
+// close removes the clone.
+func (r *gitRepository) close() {
+	os.RemoveAll(r.dir) // nolint:errcheck
+}
+
+// chartDir returns the directory containing the Helm Chart in the clone's
+// working tree.
+func (r *gitRepository) chartDir() string {
+	return filepath.Join(r.dir, filepath.FromSlash(r.chartPath))
+}
+
+// git runs the `git` executable with the supplied arguments in the clone's
+// directory and returns its standard output.
+func (r *gitRepository) git(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", r.dir}, args...)...)
+	// Never prompt for credentials.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf(
+			"git %s: %w: %s",
+			args[0], err, strings.TrimSpace(stderr.String()),
+		)
+	}
+	return stdout.Bytes(), nil
+}
+
+// tags returns the tags in the Git repository, in ascending order of creation.
+func (r *gitRepository) tags(ctx context.Context) ([]gitTag, error) {
+	b, err := r.git(
+		ctx, "for-each-ref", "--sort=creatordate",
+		"--format=%(refname:short)%09%(creatordate:iso-strict)",
+		"refs/tags",
+	)
+	if err != nil {
+		return nil, err
+	}
+	tags := []gitTag{}
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		name, created, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		tag := gitTag{name: name}
+		tag.created, _ = time.Parse(time.RFC3339, created)
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// commit returns the commit that the supplied ref (branch, tag or commit)
+// refers to. Branches other than the default branch are only known as remote
+// tracking branches in the clone.
+func (r *gitRepository) commit(ctx context.Context, ref string) (string, error) {
+	if strings.HasPrefix(ref, "-") {
+		return "", fmt.Errorf("invalid Git ref %q", ref)
+	}
+	for _, candidate := range []string{ref, "origin/" + ref} {
+		b, err := r.git(
+			ctx, "rev-parse", "--verify", "--quiet", candidate+"^{commit}",
+		)
+		if err == nil {
+			return strings.TrimSpace(string(b)), nil
+		}
+	}
+	return "", fmt.Errorf("ref %q not found in Git repository %s", ref, r.url)
+}
+
+// chartMetadata returns the Helm Chart metadata in the Chart.yaml file at the
+// supplied ref.
+func (r *gitRepository) chartMetadata(
+	ctx context.Context,
+	ref string,
+) (*helmchart.Metadata, error) {
+	b, err := r.git(
+		ctx, "show", ref+":"+path.Join(r.chartPath, "Chart.yaml"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	md := &helmchart.Metadata{}
+	if err := yaml.Unmarshal(b, md); err != nil {
+		return nil, fmt.Errorf("failed to parse Chart.yaml: %w", err)
+	}
+	return md, nil
+}
+
+// chartVersions returns a ChartVersion for each tag in the Git repository at
+// which the Helm Chart exists, along with the tag. When multiple tags have
+// the same Helm Chart version, the earliest tag is used.
+func (r *gitRepository) chartVersions(
+	ctx context.Context,
+	opts *ChartVersionsOptions,
+) ([]*ChartVersion, []string, error) {
+	tags, err := r.tags(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := []*ChartVersion{}
+	refs := []string{}
+	for _, tag := range tags {
+		md, err := r.chartMetadata(ctx, tag.name)
+		if err != nil {
+			msg := fmt.Sprintf(
+				"no chart found at tag %q: %s\n", tag.name, err,
+			)
+			opts.errorCollector.Write([]byte(msg)) // nolint:errcheck
+			continue
+		}
+		cv, err := chartVersionFromMetadata(md)
+		if err != nil {
+			msg := fmt.Sprintf("%s at tag %q\n", err, tag.name)
+			opts.errorCollector.Write([]byte(msg)) // nolint:errcheck
+			continue
+		}
+		if lo.ContainsBy(out, func(seen *ChartVersion) bool {
+			return seen.Version == cv.Version
+		}) {
+			continue
+		}
+		if !tag.created.IsZero() {
+			cv.PublishedOn = tag.created.UTC().Format(time.DateTime)
+		}
+		out = append(out, cv)
+		refs = append(refs, tag.name)
+	}
+	return out, refs, nil
+}
+
+// ChartVersionsFromGitRepository returns a slice of `ChartVersion` structs
+// describing the Helm Chart at the supplied path within the Git repository at
+// the supplied URL. A ChartVersion is returned for each tag in the Git
+// repository at which the Helm Chart exists, with the version taken from the
+// Chart.yaml file at the tag and the published date taken from the tag.
+func ChartVersionsFromGitRepository(
+	ctx context.Context,
+	repoURL string,
+	chartPath string,
+	opt ...ChartVersionsOption,
+) ([]*ChartVersion, error) {
+	ctx = debug.PushTrace(ctx, "helm:chart-versions-git")
+	defer debug.PopTrace(ctx)
+	opts := defaultChartVersionsOptions()
+	for _, o := range opt {
+		o(opts)
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	r, err := cloneGitRepository(ctx, repoURL, chartPath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.close()
+	vers, _, err := r.chartVersions(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	out := lo.Filter(vers, func(cv *ChartVersion, _ int) bool {
+		return opts.include(cv)
+	})
+	return opts.sortAndLimit(out), nil
+}
+
+// load checks out the supplied ref of the Git repository and loads the
+// Helm Chart in the working tree. If the supplied ref is empty and the
+// supplied version is not, the earliest tag at which the Helm Chart has the
+// supplied version is checked out. If both are empty, the default branch is
+// checked out.
+func (r *gitRepository) load(
+	ctx context.Context,
+	ref string,
+	version string,
+	opts *InspectOptions,
+) (*loadedChart, error) {
+	ctx = debug.PushTrace(ctx, "helm:load-git")
+	defer debug.PopTrace(ctx)
+	version = strings.TrimPrefix(version, "v")
+	if ref == "" && version != "" {
+		vers, refs, err := r.chartVersions(ctx, defaultChartVersionsOptions())
+		if err != nil {
+			return nil, err
+		}
+		_, x, ok := lo.FindIndexOf(vers, func(cv *ChartVersion) bool {
+			return cv.Version == version
+		})
+		if !ok {
+			return nil, fmt.Errorf(
+				"no tag found for chart version %q in %s", version, r.url,
+			)
+		}
+		ref = refs[x]
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	commit, err := r.commit(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.git(
+		ctx, "checkout", "--quiet", "--detach", commit,
+	); err != nil {
+		return nil, fmt.Errorf("failed to check out %q: %w", ref, err)
+	}
+	debug.Printf(ctx, "checked out %s (%s)\n", ref, commit)
+	lc, err := loadPath(ctx, r.chartDir(), opts)
+	if err != nil {
+		return nil, err
+	}
+	got := strings.TrimPrefix(lc.chart.Metadata.Version, "v")
+	if version != "" && got != version {
+		return nil, fmt.Errorf(
+			"chart at Git ref %q has version %q, expected %q",
+			ref, lc.chart.Metadata.Version, version,
+		)
+	}
+	lc.origin.SubjectType = SubjectTypeGit
+	lc.origin.URL = r.url
+	lc.origin.GitCommit = commit
+	return lc, nil
+}
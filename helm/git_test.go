@@ -0,0 +1,193 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	kihelm "github.com/jaypipes/kube-inspect/helm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeGitRepository returns the path of a local bare Git repository
+// containing a "child" chart in the charts/child directory with the following
+// history:
+//
+//   - a commit without the chart, tagged "initial"
+//   - a commit adding version 0.1.0 of the chart, tagged "v0.1.0"
+//   - a commit bumping the chart to version 0.2.0, tagged "v0.2.0" and
+//     "release-2024"
+//   - a commit bumping the chart to version 0.3.0 on the "feature" branch
+//   - a commit bumping the chart to version 0.2.1 on the default branch
+func writeGitRepository(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git executable not found")
+	}
+	require := require.New(t)
+	workDir := t.TempDir()
+	commitDate := 0
+	git := func(args ...string) {
+		// Commits and tags get increasing dates so that tag creation order
+		// is deterministic.
+		commitDate++
+		date := fmt.Sprintf("2024-01-%02dT00:00:00Z", commitDate)
+		cmd := exec.Command("git", append([]string{"-C", workDir}, args...)...)
+		cmd.Env = append(
+			os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+			"GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date,
+			"GIT_CONFIG_GLOBAL=/dev/null",
+		)
+		out, err := cmd.CombinedOutput()
+		require.Nil(err, string(out))
+	}
+	chartDir := filepath.Join(workDir, "charts", "child")
+	writeChart := func(version string) {
+		require.Nil(os.MkdirAll(filepath.Join(chartDir, "templates"), 0o755))
+		chartYAML := fmt.Sprintf(
+			"apiVersion: v2\nname: child\nversion: %s\nappVersion: %q\n",
+			version, "app-"+version,
+		)
+		require.Nil(os.WriteFile(
+			filepath.Join(chartDir, "Chart.yaml"), []byte(chartYAML), 0o644,
+		))
+		require.Nil(os.WriteFile(
+			filepath.Join(chartDir, "templates", "configmap.yaml"),
+			[]byte(childConfigMapTemplate), 0o644,
+		))
+	}
+
+	git("init", "--quiet", "--initial-branch=main")
+	require.Nil(os.WriteFile(
+		filepath.Join(workDir, "README.md"), []byte("charts\n"), 0o644,
+	))
+	git("add", "-A")
+	git("commit", "--quiet", "-m", "initial")
+	git("tag", "-a", "-m", "initial", "initial")
+	writeChart("0.1.0")
+	git("add", "-A")
+	git("commit", "--quiet", "-m", "add child 0.1.0")
+	git("tag", "-a", "-m", "v0.1.0", "v0.1.0")
+	writeChart("0.2.0")
+	git("add", "-A")
+	git("commit", "--quiet", "-m", "bump child to 0.2.0")
+	git("tag", "-a", "-m", "v0.2.0", "v0.2.0")
+	git("tag", "-a", "-m", "release-2024", "release-2024")
+	git("checkout", "--quiet", "-b", "feature")
+	writeChart("0.3.0")
+	git("add", "-A")
+	git("commit", "--quiet", "-m", "bump child to 0.3.0")
+	git("checkout", "--quiet", "main")
+	writeChart("0.2.1")
+	git("add", "-A")
+	git("commit", "--quiet", "-m", "bump child to 0.2.1")
+
+	bareDir := filepath.Join(t.TempDir(), "repo.git")
+	git("clone", "--quiet", "--bare", workDir, bareDir)
+	return bareDir
+}
+
+func TestChartVersionsFromGitRepository(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	repoDir := writeGitRepository(t)
+
+	loc, err := kihelm.ChartLocationFromURL(
+		"git+file://" + repoDir + "//charts/child",
+	)
+	require.Nil(err)
+	errs := &strings.Builder{}
+	vers, err := kihelm.ChartVersionsFromLocation(
+		ctx, loc, kihelm.ChartVersionsWithErrorCollector(errs),
+	)
+	require.Nil(err)
+	// Untagged commits are not versions, and the "release-2024" tag has the
+	// same chart version as the "v0.2.0" tag.
+	assert.Equal([]string{"0.2.0", "0.1.0"}, chartVersionStrings(vers))
+	assert.Equal("app-0.2.0", vers[0].AppVersion)
+	assert.Equal("2024-01-10 00:00:00", vers[0].PublishedOn)
+	assert.Contains(errs.String(), `no chart found at tag "initial"`)
+}
+
+func TestInspectLocationGit(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+	repoDir := writeGitRepository(t)
+	repoURL := "git+file://" + repoDir + "//charts/child"
+
+	tcs := []struct {
+		name       string
+		url        string
+		version    string
+		expVersion string
+		expErr     string
+	}{
+		{"default branch", repoURL, "", "0.2.1", ""},
+		{"version from tag", repoURL, "0.1.0", "0.1.0", ""},
+		{"tag ref", repoURL + "?ref=v0.2.0", "", "0.2.0", ""},
+		{"branch ref", repoURL + "?ref=feature", "", "0.3.0", ""},
+		{
+			"ref and version mismatch",
+			repoURL + "?ref=v0.2.0",
+			"0.1.0",
+			"",
+			`has version "0.2.0", expected "0.1.0"`,
+		},
+		{"unknown version", repoURL, "9.9.9", "", "no tag found"},
+		{"unknown ref", repoURL + "?ref=nope", "", "", "not found"},
+		{
+			"uncleaned chart path",
+			"git+file://" + repoDir + "//charts/./child/",
+			"",
+			"0.2.1",
+			"",
+		},
+		{
+			"chart path outside repository",
+			"git+file://" + repoDir + "//charts/../../outside",
+			"",
+			"",
+			"outside the Git repository",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+			assert := assert.New(t)
+			loc, err := kihelm.ChartLocationFromURL(tc.url)
+			require.Nil(err)
+			c, err := kihelm.InspectLocation(ctx, loc, tc.version)
+			if tc.expErr != "" {
+				require.NotNil(err)
+				assert.Contains(err.Error(), tc.expErr)
+				return
+			}
+			require.Nil(err)
+			assert.Equal(tc.expVersion, c.Metadata.Version)
+			o := c.Origin()
+			assert.Equal(kihelm.SubjectTypeGit, o.SubjectType)
+			assert.Equal(loc, o.Location)
+			assert.Equal("file://"+repoDir, o.URL)
+			assert.Len(o.GitCommit, 40)
+			res, err := c.Resources(ctx)
+			require.Nil(err)
+			assert.Len(res, 1)
+		})
+	}
+
+	_, err := kihelm.InspectLocation(
+		ctx, &kihelm.ChartLocation{URL: "git+file:///does/not/exist"}, "",
+	)
+	require.NotNil(err)
+}
@@ -0,0 +1,92 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/samber/lo"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/jaypipes/kube-inspect/debug"
+	"github.com/jaypipes/kube-inspect/kube"
+)
+
+// Hook describes a Kubernetes resource that the Helm Chart installs as a Helm
+// hook, e.g. a database migration Job that runs before an upgrade or a Pod
+// that runs during `helm test`.
+type Hook struct {
+	// Resource is the Kubernetes resource rendered for the hook.
+	Resource *unstructured.Unstructured
+	// Path is the path of the template that rendered the hook, e.g.
+	// "nginx/templates/tests/test-connection.yaml".
+	Path string
+	// Events contains the hook events (e.g. "pre-install", "post-upgrade" or
+	// "test") that trigger the hook.
+	Events []string
+	// Weight is the hook weight used by Helm to order hooks that are
+	// triggered by the same event.
+	Weight int
+	// DeletePolicies contains the hook deletion policies (e.g.
+	// "before-hook-creation" or "hook-succeeded") for the hook.
+	DeletePolicies []string
+}
+
+// Hooks returns a slice of Helm hooks rendered by the Helm Chart whose
+// resources match a supplied filter.
+//
+// Hooks are always returned by this method, regardless of whether WithHooks()
+// was passed to Inspect().
+func (c *Chart) Hooks(
+	ctx context.Context,
+	filters ...kube.ResourceFilter,
+) ([]*Hook, error) {
+	if !c.rendered {
+		if err := c.render(ctx); err != nil {
+			return nil, err
+		}
+	}
+	ctx = debug.PushTrace(ctx, "helm:chart:hooks")
+	defer debug.PopTrace(ctx)
+	res := []*Hook{}
+	for _, h := range c.hooks {
+		resources, err := kube.ResourcesFromManifest(
+			ctx, bytes.NewBufferString(h.Manifest),
+		)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to process manifest for hook %q: %w", h.Path, err,
+			)
+		}
+		events := lo.Map(
+			h.Events, func(e release.HookEvent, _ int) string {
+				return string(e)
+			},
+		)
+		policies := lo.Map(
+			h.DeletePolicies, func(p release.HookDeletePolicy, _ int) string {
+				return string(p)
+			},
+		)
+		for _, r := range resources {
+			res = append(res, &Hook{
+				Resource:       r,
+				Path:           h.Path,
+				Events:         events,
+				Weight:         h.Weight,
+				DeletePolicies: policies,
+			})
+		}
+	}
+	for _, f := range filters {
+		res = lo.Filter(res, func(h *Hook, x int) bool {
+			return f(h.Resource, x)
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,75 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	kihelm "github.com/jaypipes/kube-inspect/helm"
+	"github.com/jaypipes/kube-inspect/kube"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	hooksLocalChartDir = filepath.Join("testdata", "hooks")
+)
+
+func TestHooks(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	c, err := kihelm.Inspect(ctx, hooksLocalChartDir)
+	require.Nil(err)
+
+	hooks, err := c.Hooks(ctx)
+	require.Nil(err)
+	assert.Len(hooks, 2)
+
+	jobs, err := c.Hooks(ctx, kube.WithKind("Job"))
+	require.Nil(err)
+	require.Len(jobs, 1)
+	job := jobs[0]
+	assert.Equal("kube-inspect-migrate", job.Resource.GetName())
+	assert.Equal("hooks/templates/migrate-job.yaml", job.Path)
+	assert.Equal([]string{"pre-install", "pre-upgrade"}, job.Events)
+	assert.Equal(-5, job.Weight)
+	assert.Equal(
+		[]string{"before-hook-creation", "hook-succeeded"},
+		job.DeletePolicies,
+	)
+
+	tests, err := c.Hooks(ctx, kube.WithKind("Pod"))
+	require.Nil(err)
+	require.Len(tests, 1)
+	assert.Equal([]string{"test"}, tests[0].Events)
+
+	// Hook resources are not included in the chart's resources unless
+	// WithHooks() is supplied.
+	resources, err := c.Resources(ctx)
+	require.Nil(err)
+	assert.Len(resources, 1)
+}
+
+func TestInspectWithHooks(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	c, err := kihelm.Inspect(ctx, hooksLocalChartDir, kihelm.WithHooks())
+	require.Nil(err)
+
+	resources, err := c.Resources(ctx)
+	require.Nil(err)
+	resourceKinds := []string{}
+	for _, r := range resources {
+		resourceKinds = append(resourceKinds, r.GetKind())
+	}
+	assert.Len(resources, 3)
+	assert.Contains(resourceKinds, "ConfigMap")
+	assert.Contains(resourceKinds, "Job")
+	assert.Contains(resourceKinds, "Pod")
+}
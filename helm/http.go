@@ -0,0 +1,237 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	helmrepo "helm.sh/helm/v3/pkg/repo"
+)
+
+const (
+	// DefaultHTTPTimeout is the timeout for HTTP requests made when fetching
+	// Helm Chart archives and Helm repository index files if WithHTTPClient()
+	// is not supplied.
+	DefaultHTTPTimeout = 5 * time.Minute
+)
+
+// httpOptions controls the HTTP requests made when fetching Helm Chart
+// archives and Helm repository index files.
+type httpOptions struct {
+	// client is the HTTP client used to make requests. If nil, a client with
+	// DefaultHTTPTimeout is used.
+	client *http.Client
+	// username and password are sent using HTTP basic authentication.
+	username string
+	password string
+	// bearerToken is sent in an "Authorization: Bearer" header.
+	bearerToken string
+	// caFile is the path to a PEM-encoded bundle of CA certificates used to
+	// verify the server's TLS certificate, in addition to the system's CA
+	// certificates.
+	caFile string
+	// certFile and keyFile are the paths to a PEM-encoded TLS client
+	// certificate and key.
+	certFile string
+	keyFile  string
+	// insecureSkipTLSVerify skips verification of the server's TLS
+	// certificate.
+	insecureSkipTLSVerify bool
+	// passCredentialsAll indicates that credentials are sent when fetching
+	// Helm Chart archives from a different host than the Helm repository.
+	passCredentialsAll bool
+}
+
+// WithHTTPClient sets the HTTP client used when fetching Helm Chart archives
+// and Helm repository index files.
+func WithHTTPClient(client *http.Client) InspectOption {
+	return func(opts *InspectOptions) {
+		opts.http.client = client
+	}
+}
+
+// WithBasicAuth sets the username and password sent, using HTTP basic
+// authentication, when fetching Helm Chart archives and Helm repository index
+// files.
+func WithBasicAuth(username, password string) InspectOption {
+	return func(opts *InspectOptions) {
+		opts.http.username = username
+		opts.http.password = password
+	}
+}
+
+// WithBearerToken sets the token sent in an "Authorization: Bearer" header
+// when fetching Helm Chart archives and Helm repository index files.
+func WithBearerToken(token string) InspectOption {
+	return func(opts *InspectOptions) {
+		opts.http.bearerToken = token
+	}
+}
+
+// WithCAFile sets the path to a PEM-encoded bundle of CA certificates used to
+// verify the TLS certificates of servers when fetching Helm Chart archives and
+// Helm repository index files. The CA certificates are used in addition to the
+// system's CA certificates.
+func WithCAFile(path string) InspectOption {
+	return func(opts *InspectOptions) {
+		opts.http.caFile = path
+	}
+}
+
+// WithPassCredentialsAll instructs Inspect to send the credentials supplied
+// with WithBasicAuth() or WithBearerToken() when fetching Helm Chart archives
+// from a different scheme or host than the Helm repository that lists them.
+// By default, as with the helm CLI, credentials are only sent to the Helm
+// repository's own host.
+func WithPassCredentialsAll() InspectOption {
+	return func(opts *InspectOptions) {
+		opts.http.passCredentialsAll = true
+	}
+}
+
+// forRepository returns the httpOptions to use when fetching the supplied
+// URL listed in the Helm repository at the supplied repository URL. The
+// returned httpOptions have no credentials if the URL's scheme and host differ
+// from the Helm repository's, unless WithPassCredentialsAll() was supplied.
+func (o *httpOptions) forRepository(
+	repoURL string,
+	target string,
+) *httpOptions {
+	if o.passCredentialsAll || sameSchemeAndHost(repoURL, target) {
+		return o
+	}
+	noCreds := *o
+	noCreds.username = ""
+	noCreds.password = ""
+	noCreds.bearerToken = ""
+	return &noCreds
+}
+
+// sameSchemeAndHost returns true if the supplied URLs have the same scheme and
+// host (including port).
+func sameSchemeAndHost(a string, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return ua.Scheme == ub.Scheme && ua.Host == ub.Host
+}
+
+// withRepositoryConfig returns a copy of the httpOptions with the credentials,
+// CA file, TLS client certificate and TLS settings from the supplied helm CLI
+// repository configuration, unless overridden by the httpOptions.
+func (o httpOptions) withRepositoryConfig(entry *helmrepo.Entry) *httpOptions {
+	if o.username == "" && o.bearerToken == "" {
+		o.username = entry.Username
+		o.password = entry.Password
+	}
+	if o.caFile == "" {
+		o.caFile = entry.CAFile
+	}
+	if o.certFile == "" {
+		o.certFile = entry.CertFile
+		o.keyFile = entry.KeyFile
+	}
+	o.insecureSkipTLSVerify = o.insecureSkipTLSVerify ||
+		entry.InsecureSkipTLSverify
+	o.passCredentialsAll = o.passCredentialsAll || entry.PassCredentialsAll
+	return &o
+}
+
+// httpClient returns the HTTP client to use for requests, configured with any
+// custom CA certificates, client certificate and TLS verification options.
+func (o *httpOptions) httpClient() (*http.Client, error) {
+	client := o.client
+	if client == nil {
+		client = &http.Client{Timeout: DefaultHTTPTimeout}
+	}
+	if o.caFile == "" && o.certFile == "" && !o.insecureSkipTLSVerify {
+		return client, nil
+	}
+	var transport *http.Transport
+	if t, ok := client.Transport.(*http.Transport); ok {
+		transport = t.Clone()
+	} else {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	if o.insecureSkipTLSVerify {
+		transport.TLSClientConfig.InsecureSkipVerify = true // nolint:gosec
+	}
+	if o.caFile != "" {
+		pem, err := os.ReadFile(o.caFile)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to read CA file %q: %w", o.caFile, err,
+			)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf(
+				"no certificates found in CA file %q", o.caFile,
+			)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	if o.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+	// copy the client so that we don't modify the caller's client
+	withTLS := *client
+	withTLS.Transport = transport
+	return &withTLS, nil
+}
+
+// get performs an HTTP GET request for the supplied URL, applying any
+// authentication. Callers are responsible for closing the response body.
+//
+// Returns an error if the response status is not 200 OK.
+func (o *httpOptions) get(
+	ctx context.Context,
+	url string,
+) (*http.Response, error) {
+	client, err := o.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if o.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+o.bearerToken)
+	} else if o.username != "" || o.password != "" {
+		req.SetBasicAuth(o.username, o.password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("non-ok read from %q: %d", url, resp.StatusCode)
+	}
+	return resp, nil
+}
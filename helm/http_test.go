@@ -0,0 +1,258 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm_test
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	kihelm "github.com/jaypipes/kube-inspect/helm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	helmrepo "helm.sh/helm/v3/pkg/repo"
+)
+
+const (
+	testUsername    = "artifactory"
+	testPassword    = "s3cr3t"
+	testBearerToken = "t0k3n"
+)
+
+// serveAuthenticatedHelmRepository starts an HTTPS server serving a Helm
+// repository that contains version 0.1.0 of a "child" chart. Requests must
+// use either basic authentication or a bearer token. Returns the server and
+// the path to a CA file containing the server's certificate.
+func serveAuthenticatedHelmRepository(t *testing.T) (*httptest.Server, string) {
+	require := require.New(t)
+	repoDir := writeHelmRepository(t, "0.1.0")
+	fs := http.FileServer(http.Dir(repoDir))
+	srv := httptest.NewTLSServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, pass, ok := r.BasicAuth()
+			basicOK := ok && user == testUsername && pass == testPassword
+			bearerOK := r.Header.Get("Authorization") == "Bearer "+testBearerToken
+			if !basicOK && !bearerOK {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fs.ServeHTTP(w, r)
+		}),
+	)
+	t.Cleanup(srv.Close)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(
+		&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw},
+	)
+	require.Nil(os.WriteFile(caFile, caPEM, 0o644))
+	return srv, caFile
+}
+
+func TestInspectArchiveWithAuthAndCAFile(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	srv, caFile := serveAuthenticatedHelmRepository(t)
+	archiveURL := srv.URL + "/child-0.1.0.tgz"
+
+	// The server's certificate is not trusted without the CA file
+	_, err := kihelm.Inspect(
+		ctx, archiveURL,
+		kihelm.WithBasicAuth(testUsername, testPassword),
+	)
+	require.NotNil(err)
+	assert.ErrorContains(err, "certificate")
+
+	_, err = kihelm.Inspect(ctx, archiveURL, kihelm.WithCAFile(caFile))
+	require.NotNil(err)
+	assert.ErrorContains(err, "401")
+
+	c, err := kihelm.Inspect(
+		ctx, archiveURL,
+		kihelm.WithCAFile(caFile),
+		kihelm.WithBasicAuth(testUsername, testPassword),
+	)
+	require.Nil(err)
+	assert.Equal("child", c.Name())
+
+	c, err = kihelm.Inspect(
+		ctx, archiveURL,
+		kihelm.WithCAFile(caFile),
+		kihelm.WithBearerToken(testBearerToken),
+	)
+	require.Nil(err)
+	assert.Equal("child", c.Name())
+
+	// A supplied HTTP client is used for requests
+	c, err = kihelm.Inspect(
+		ctx, archiveURL,
+		kihelm.WithHTTPClient(srv.Client()),
+		kihelm.WithBearerToken(testBearerToken),
+	)
+	require.Nil(err)
+	assert.Equal("child", c.Name())
+}
+
+func TestInspectArchiveContextCancelled(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	srv := serveHelmRepository(t, "0.1.0")
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	_, err := kihelm.Inspect(ctx, srv.URL+"/child-0.1.0.tgz")
+	require.NotNil(err)
+	assert.ErrorIs(err, context.Canceled)
+}
+
+func TestChartVersionsFromHelmRepositoryWithAuth(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	srv, caFile := serveAuthenticatedHelmRepository(t)
+
+	loc, err := kihelm.ChartLocationFromURL(srv.URL + "/child")
+	require.Nil(err)
+	repo, err := loc.HelmRepository()
+	require.Nil(err)
+
+	_, err = kihelm.ChartVersionsFromHelmRepository(
+		ctx, repo, loc.Name, kihelm.ChartVersionsWithCAFile(caFile),
+	)
+	require.NotNil(err)
+	assert.ErrorContains(err, "401")
+
+	vers, err := kihelm.ChartVersionsFromHelmRepository(
+		ctx, repo, loc.Name,
+		kihelm.ChartVersionsWithCAFile(caFile),
+		kihelm.ChartVersionsWithBasicAuth(testUsername, testPassword),
+	)
+	require.Nil(err)
+	require.Len(vers, 1)
+	assert.Equal("0.1.0", vers[0].Version)
+
+	// Credentials and TLS settings in the Helm repository's configuration are
+	// used if not overridden.
+	repo.Config.Username = testUsername
+	repo.Config.Password = testPassword
+	repo.Config.InsecureSkipTLSverify = true
+	vers, err = kihelm.ChartVersionsFromHelmRepository(ctx, repo, loc.Name)
+	require.Nil(err)
+	require.Len(vers, 1)
+}
+
+func TestInspectLocationCredentialsOnlySentToRepositoryHost(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	// The Helm repository's index file refers to a Helm Chart archive on a
+	// different host, which records the Authorization headers it receives.
+	archiveDir := writeHelmRepository(t, "0.1.0")
+	var mu sync.Mutex
+	archiveAuth := []string{}
+	archiveSrv := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			archiveAuth = append(archiveAuth, r.Header.Get("Authorization"))
+			mu.Unlock()
+			http.FileServer(http.Dir(archiveDir)).ServeHTTP(w, r)
+		}),
+	)
+	t.Cleanup(archiveSrv.Close)
+	seenAuth := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, archiveAuth...)
+	}
+	idx, err := helmrepo.LoadIndexFile(filepath.Join(archiveDir, "index.yaml"))
+	require.Nil(err)
+	idx.Entries["child"][0].URLs = []string{archiveSrv.URL + "/child-0.1.0.tgz"}
+	repoDir := t.TempDir()
+	require.Nil(idx.WriteFile(filepath.Join(repoDir, "index.yaml"), 0o644))
+	repoSrv := httptest.NewServer(http.FileServer(http.Dir(repoDir)))
+	t.Cleanup(repoSrv.Close)
+	loc, err := kihelm.ChartLocationFromURL(repoSrv.URL + "/child")
+	require.Nil(err)
+
+	c, err := kihelm.InspectLocation(
+		ctx, loc, "0.1.0", kihelm.WithBearerToken(testBearerToken),
+	)
+	require.Nil(err)
+	assert.Equal("child", c.Name())
+	assert.Equal([]string{""}, seenAuth())
+
+	c, err = kihelm.InspectLocation(
+		ctx, loc, "0.1.0",
+		kihelm.WithBearerToken(testBearerToken),
+		kihelm.WithPassCredentialsAll(),
+	)
+	require.Nil(err)
+	assert.Equal("child", c.Name())
+	assert.Equal([]string{"", "Bearer " + testBearerToken}, seenAuth())
+}
+
+func TestInspectLocationWithoutArchiveURLs(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+	idx, err := helmrepo.LoadIndexFile(
+		filepath.Join(writeHelmRepository(t, "0.1.0"), "index.yaml"),
+	)
+	require.Nil(err)
+	idx.Entries["child"][0].URLs = nil
+	repoDir := t.TempDir()
+	require.Nil(idx.WriteFile(filepath.Join(repoDir, "index.yaml"), 0o644))
+	srv := httptest.NewServer(http.FileServer(http.Dir(repoDir)))
+	t.Cleanup(srv.Close)
+	loc, err := kihelm.ChartLocationFromURL(srv.URL + "/child")
+	require.Nil(err)
+
+	_, err = kihelm.InspectLocation(ctx, loc, "0.1.0")
+	require.NotNil(err)
+	require.ErrorContains(err, "has no URLs")
+}
+
+func TestChartLocationFromHelmRefWithAuth(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	srv, caFile := serveAuthenticatedHelmRepository(t)
+	repoConfig := filepath.Join(t.TempDir(), "repositories.yaml")
+	rf := helmrepo.NewFile()
+	rf.Add(&helmrepo.Entry{
+		Name:     "private",
+		URL:      srv.URL,
+		Username: testUsername,
+		Password: testPassword,
+		CAFile:   caFile,
+	})
+	require.Nil(rf.WriteFile(repoConfig, 0o644))
+	loc, err := kihelm.ChartLocationFromHelmRef(
+		ctx, "private/child",
+		kihelm.ChartLocationWithRepositoryConfig(repoConfig),
+	)
+	require.Nil(err)
+
+	// The credentials and CA file in the repository configuration are used
+	vers, err := kihelm.ChartVersionsFromLocation(ctx, loc)
+	require.Nil(err)
+	require.Len(vers, 1)
+	assert.Equal("0.1.0", vers[0].Version)
+
+	c, err := kihelm.InspectLocation(ctx, loc, "0.1.0")
+	require.Nil(err)
+	assert.Equal("child", c.Name())
+
+	// Credentials supplied with options take precedence
+	_, err = kihelm.InspectLocation(
+		ctx, loc, "0.1.0", kihelm.WithBasicAuth(testUsername, "wrong"),
+	)
+	require.NotNil(err)
+	assert.ErrorContains(err, "401")
+}
@@ -5,21 +5,20 @@
 package helm
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
-	"log"
-	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
-	"helm.sh/helm/v3/pkg/action"
 	helmchart "helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
-	"helm.sh/helm/v3/pkg/cli"
+	helmchartutil "helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/registry"
-	"helm.sh/helm/v3/pkg/strvals"
 
 	"github.com/jaypipes/kube-inspect/debug"
 )
@@ -35,10 +34,81 @@ type InspectOptions struct {
 	chartVersion string
 	// registryClient specifies an optional Helm registry client object to use
 	// when fetching/pulling the chart. Only used when the user specified an
-	// OCI registry URL as the subject parameter for Inspect().
+	// OCI registry URL as the subject parameter for Inspect(). If nil, the
+	// chart is pulled directly from the OCI registry.
 	registryClient *registry.Client
-
+	// oci contains options for connecting to OCI registries when
+	// registryClient is nil.
+	oci []OCIOption
+	// releaseName is the name of the Helm Release used when rendering the
+	// chart. Defaults to DefaultReleaseName.
+	releaseName string
+	// namespace is the Kubernetes Namespace that the chart is rendered into.
+	// Defaults to DefaultNamespace.
+	namespace string
+	// includeHooks indicates that Helm hooks should be rendered along with
+	// the chart's regular resources.
+	includeHooks bool
+	// skipCRDs indicates that the CustomResourceDefinitions in the chart's
+	// crds/ directory should not be included in the rendered resources.
+	skipCRDs bool
+	// kubeVersion is the Kubernetes version to render the chart against. If
+	// empty, a Kubernetes version is automatically determined from the
+	// chart's KubeVersion constraint.
+	kubeVersion string
+	// apiVersions is a set of additional Kubernetes API versions (e.g.
+	// "monitoring.coreos.com/v1") that are available when rendering the
+	// chart.
+	apiVersions []string
+	// valuesLayers are the values files, readers and maps that are merged, in
+	// order, to form the base values for rendering the chart.
+	valuesLayers []valuesLayer
+	// jsonValues are `--set-json` style values.
+	jsonValues []string
+	// setValues are `--set` style values.
+	setValues []string
+	// stringValues are `--set-string` style values.
+	stringValues []string
+	// fileValues are `--set-file` style values.
+	fileValues []string
+	// values is the result of merging all of the above values sources.
 	values map[string]any
+	// resolveDependencies indicates that dependencies missing from the
+	// chart's charts/ directory should be fetched.
+	resolveDependencies bool
+	// offline indicates that Helm Chart archives, OCI artifacts and Helm
+	// repository index files should only be read from the chart cache.
+	offline bool
+	// http controls the HTTP requests made when fetching Helm Chart archives
+	// and Helm repository index files.
+	http httpOptions
+	// cacheDir is the directory of the on-disk chart cache. If empty, fetched
+	// Helm Chart archives and Helm repository index files are not cached.
+	cacheDir string
+	// cacheTTL is the length of time that chart cache entries are fresh.
+	cacheTTL time.Duration
+	// keyring is the path to the PGP public keyring used to verify the
+	// provenance of the chart. If empty, the chart is not verified.
+	keyring string
+}
+
+const (
+	// DefaultReleaseName is the name of the Helm Release used when rendering
+	// a Helm Chart if WithReleaseName() is not supplied to Inspect().
+	DefaultReleaseName = "kube-inspect"
+	// DefaultNamespace is the Kubernetes Namespace that a Helm Chart is
+	// rendered into if WithNamespace() is not supplied to Inspect().
+	DefaultNamespace = "default"
+)
+
+// defaultInspectOptions returns the default options we use when inspecting a
+// Helm Chart.
+func defaultInspectOptions() *InspectOptions {
+	return &InspectOptions{
+		releaseName: DefaultReleaseName,
+		namespace:   DefaultNamespace,
+		cacheTTL:    DefaultCacheTTL,
+	}
 }
 
 type InspectOption func(opts *InspectOptions)
@@ -48,14 +118,30 @@ type InspectOption func(opts *InspectOptions)
 // The `vals` parameter should be a string or a map of string to interface.
 //
 // You may choose to pass a "strvals" single string, e.g. "pdb.create=true",
-// instead of a nested map.
+// instead of a nested map. A string is the equivalent of passing `--set` to
+// the helm CLI while a map is treated the same as a values file (see
+// WithValuesFiles()).
 func WithValues(vals any) InspectOption {
 	return func(opts *InspectOptions) {
 		switch vals := vals.(type) {
 		case string:
-			opts.values, _ = strvals.Parse(vals)
+			opts.setValues = append(opts.setValues, vals)
 		case map[string]any:
-			opts.values = vals
+			opts.valuesLayers = append(
+				opts.valuesLayers,
+				func() (map[string]any, error) {
+					return vals, nil
+				},
+			)
+		default:
+			opts.valuesLayers = append(
+				opts.valuesLayers,
+				func() (map[string]any, error) {
+					return nil, fmt.Errorf(
+						"unhandled type for values: %T", vals,
+					)
+				},
+			)
 		}
 	}
 }
@@ -71,7 +157,8 @@ func WithChartName(name string) InspectOption {
 
 // WithChartVersion adds a chart version specifier to the Inspect chart
 // fetching operation. Only used when pulling from an OCI registry (when
-// subject is an OCI registry URL).
+// subject is an OCI registry URL). The version is the tag of the Helm Chart
+// OCI artifact or an OCI manifest digest, e.g. "sha256:1a2b...".
 func WithChartVersion(version string) InspectOption {
 	return func(opts *InspectOptions) {
 		opts.chartVersion = version
@@ -81,91 +168,162 @@ func WithChartVersion(version string) InspectOption {
 // WithRegistryClient adds a Helm Registry client to the Inspect chart fetching
 // operation. Only used when pulling from an OCI registry (when subject is an
 // OCI registry URL).
+//
+// Deprecated: Helm Charts are pulled directly from OCI registries without a
+// Helm registry client. Use WithOCIOptions() to supply credentials and
+// connection settings instead.
 func WithRegistryClient(c *registry.Client) InspectOption {
 	return func(opts *InspectOptions) {
 		opts.registryClient = c
 	}
 }
 
+// WithReleaseName sets the name of the Helm Release used when rendering the
+// Helm Chart. This affects any resource names and labels that the chart's
+// templates derive from `.Release.Name`. Defaults to DefaultReleaseName.
+func WithReleaseName(name string) InspectOption {
+	return func(opts *InspectOptions) {
+		opts.releaseName = name
+	}
+}
+
+// WithNamespace sets the Kubernetes Namespace that the Helm Chart is rendered
+// into, i.e. the value of `.Release.Namespace` in the chart's templates.
+// Defaults to DefaultNamespace.
+func WithNamespace(namespace string) InspectOption {
+	return func(opts *InspectOptions) {
+		opts.namespace = namespace
+	}
+}
+
+// WithHooks instructs Inspect to render the Helm Chart's hooks (e.g.
+// pre-install Jobs and test Pods) in addition to its regular resources. By
+// default, hooks are not rendered.
+func WithHooks() InspectOption {
+	return func(opts *InspectOptions) {
+		opts.includeHooks = true
+	}
+}
+
+// WithoutCRDs instructs Inspect to exclude the CustomResourceDefinitions in
+// the Helm Chart's crds/ directory from the rendered resources. By default,
+// these CRDs are included.
+func WithoutCRDs() InspectOption {
+	return func(opts *InspectOptions) {
+		opts.skipCRDs = true
+	}
+}
+
+// WithKubeVersion sets the Kubernetes version (e.g. "1.29.3") that the Helm
+// Chart is rendered against, i.e. the value of `.Capabilities.KubeVersion` in
+// the chart's templates. If not supplied, a Kubernetes version that satisfies
+// the chart's KubeVersion constraint is automatically chosen.
+func WithKubeVersion(version string) InspectOption {
+	return func(opts *InspectOptions) {
+		opts.kubeVersion = version
+	}
+}
+
+// WithAPIVersions adds Kubernetes API versions (e.g.
+// "monitoring.coreos.com/v1" or "monitoring.coreos.com/v1/ServiceMonitor") to
+// the set of API versions that are available when rendering the Helm Chart.
+// This affects the result of `.Capabilities.APIVersions.Has` in the chart's
+// templates.
+func WithAPIVersions(versions ...string) InspectOption {
+	return func(opts *InspectOptions) {
+		opts.apiVersions = append(opts.apiVersions, versions...)
+	}
+}
+
 // Inspect returns a `Chart` that describes a Helm Chart that has been rendered
 // to actual Kubernetes resource manifests.
 //
 // The `subject` argument can be a filepath, a URL, a helm sdk-go `*Chart`
 // struct, or an `io.Reader` pointing at either a directory or a compressed tar
 // archive. If `subject` is a an OCI registry URL, then the function will
-// attempt to pull the Helm Chart from the supplied OCI registry and unpack it
-// to a local directory.
+// attempt to pull the Helm Chart from the supplied OCI registry. The OCI
+// registry URL may include a tag (e.g. `oci://quay.io/charts/child:1.2.3`) or
+// an OCI manifest digest (e.g. `oci://quay.io/charts/child@sha256:1a2b...`),
+// otherwise WithChartVersion() must be supplied. The OCI manifest digest that
+// the Helm Chart was pulled from is reported in Chart.Origin().
 func Inspect(
 	ctx context.Context,
 	subject any,
 	opt ...InspectOption,
 ) (*Chart, error) {
-	opts := &InspectOptions{}
-	for _, o := range opt {
-		o(opts)
-	}
 	ctx = debug.PushTrace(ctx, "helm:inspect")
 	defer debug.PopTrace(ctx)
-	var err error
-	var hc *helmchart.Chart
+	opts, err := newInspectOptions(opt...)
+	if err != nil {
+		return nil, err
+	}
+	var lc *loadedChart
+	// chartDir is the directory containing the unpacked Helm Chart, if any.
+	chartDir := ""
 	switch subject := subject.(type) {
 	case string:
 		if registry.IsOCI(subject) {
-			rc := opts.registryClient
-			if rc == nil {
-				rc, err = registry.NewClient()
-				if err != nil {
-					return nil, fmt.Errorf("failed to create default registry client: %w", err)
-				}
-			}
+			repoURL, ref := splitOCIReference(subject)
 			chartVersion := opts.chartVersion
+			switch {
+			case ref == "":
+			case chartVersion == "":
+				chartVersion = ref
+			case chartVersion != ref:
+				return nil, fmt.Errorf(
+					"OCI reference %s conflicts with chart version %q",
+					subject, chartVersion,
+				)
+			}
 			if chartVersion == "" {
 				return nil, fmt.Errorf(
 					"missing required chart version argument. " +
-						"use WithChartVersion() when passing an OCI " +
-						"registry URL to Inspect().",
+						"use WithChartVersion() or include a tag or " +
+						"digest when passing an OCI registry URL to " +
+						"Inspect().",
 				)
 			}
-			untarDir, err := fetchOCI(ctx, subject, chartVersion, rc)
-			if err != nil {
-				return nil, err
-			}
-			defer os.RemoveAll(untarDir)
-			// untarDir is a directory that contains a single directory with a
-			// name equal to the Helm Chart...
-			chartDir, err := firstDir(untarDir)
-			if err != nil {
-				return nil, err
-			}
-			hc, err = loader.Load(chartDir)
+			lc, err = loadOCI(ctx, repoURL, chartVersion, opts)
 			if err != nil {
 				return nil, err
 			}
 		} else if strings.HasPrefix(subject, "http") {
-			tf, err := fetchArchive(ctx, subject)
+			lc, err = loadArchiveURL(ctx, subject, "", &opts.http, opts)
 			if err != nil {
 				return nil, err
 			}
-			defer os.Remove(tf.Name())
-			hc, err = loader.LoadArchive(tf)
-			if err != nil {
-				return nil, fmt.Errorf("error loading archive: %w", err)
-			}
 		} else {
-			hc, err = loader.Load(subject)
+			lc, err = loadPath(ctx, subject, opts)
 			if err != nil {
 				return nil, err
 			}
+			if lc.origin.SubjectType == SubjectTypeDirectory {
+				chartDir = subject
+			}
 		}
 	case *helmchart.Chart:
 		if subject == nil {
 			return nil, fmt.Errorf("passed nil helm sdk-go *Chart struct")
 		}
-		hc = subject
+		lc = &loadedChart{
+			chart:  subject,
+			origin: &Origin{SubjectType: SubjectTypeChart},
+		}
 	case io.Reader:
-		hc, err = loader.LoadArchive(subject)
+		data, err := io.ReadAll(subject)
+		if err != nil {
+			return nil, fmt.Errorf("error reading archive: %w", err)
+		}
+		hc, err := loadArchiveData(data)
 		if err != nil {
-			return nil, fmt.Errorf("error loading archive: %w", err)
+			return nil, err
+		}
+		lc = &loadedChart{
+			chart: hc,
+			origin: &Origin{
+				SubjectType: SubjectTypeReader,
+				Digest:      digestOf(data),
+			},
 		}
 	default:
 		return nil, fmt.Errorf(
@@ -173,99 +331,330 @@ func Inspect(
 			subject, subject,
 		)
 	}
-	return &Chart{
-		Chart:       hc,
-		inspectOpts: opts,
-	}, nil
+	if opts.keyring != "" && lc.verification == nil {
+		return nil, fmt.Errorf(
+			"cannot verify inspect subject of type %T", subject,
+		)
+	}
+	return newChart(ctx, lc, chartDir, opts)
 }
 
-// fetchArchive reads the tarball at the supplied URL, copies it to a temporary
-// file and returns the temporary file. callers are responsible for removing
-// the temporary file.
-func fetchArchive(
+// InspectLocation returns a `Chart` that describes the supplied version of the
+// Helm Chart at the supplied ChartLocation.
+//
+// For a Helm repository ChartLocation, the Helm Chart archive URL is resolved
+// from the Helm repository's index file. If `version` is empty, the latest
+// (non pre-release) version in the index file is used. If the ChartLocation
+// was resolved by ChartLocationFromHelmRef(), any credentials and TLS settings
+// in the helm CLI's repository configuration are used unless overridden with
+// WithBasicAuth(), WithBearerToken() or WithCAFile(). For an OCI repository
+// ChartLocation, the Helm Chart OCI artifact with a tag (or OCI manifest
+// digest, see ChartVersion.OCIManifestDigest) equal to `version` is pulled.
+// For a local ChartLocation, `version`, if not empty, must match the version
+// of the Helm Chart, unless the ChartLocation refers to a directory of Helm
+// Chart archives, in which case the archive with the matching (or, if
+// `version` is empty, highest) version is used.
+//
+// For a Git repository ChartLocation, the Git repository is cloned and the
+// ref in the ChartLocation is checked out. If the ChartLocation has no ref,
+// the earliest tag at which the Helm Chart has a version equal to `version`
+// is checked out or, if `version` is empty, the default branch.
+func InspectLocation(
 	ctx context.Context,
-	url string,
-) (*os.File, error) {
-	ctx = debug.PushTrace(ctx, "helm:fetch-archive")
+	loc *ChartLocation,
+	version string,
+	opt ...InspectOption,
+) (*Chart, error) {
+	if loc == nil {
+		return nil, fmt.Errorf("passed nil ChartLocation")
+	}
+	ctx = debug.PushTrace(ctx, "helm:inspect-location")
 	defer debug.PopTrace(ctx)
-	resp, err := http.Get(url)
+	switch {
+	case loc.IsOCI():
+		if version == "" {
+			return nil, fmt.Errorf(
+				"missing required chart version argument for OCI " +
+					"ChartLocation.",
+			)
+		}
+		return Inspect(ctx, loc.URL, append(opt, WithChartVersion(version))...)
+	case loc.IsLocal():
+		path := strings.TrimPrefix(loc.URL, "file://")
+		// A directory that is not an unpacked Helm Chart directory contains
+		// multiple Helm Chart archives.
+		if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+			if ok, _ := helmchartutil.IsChartDir(path); !ok {
+				path, err = localArchivePath(ctx, path, loc.Name, version)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		c, err := Inspect(ctx, path, opt...)
+		if err != nil {
+			return nil, err
+		}
+		if version != "" && c.Metadata.Version != version {
+			return nil, fmt.Errorf(
+				"chart at %s has version %q, expected %q",
+				loc, c.Metadata.Version, version,
+			)
+		}
+		c.origin.Location = loc
+		return c, nil
+	case loc.IsGit():
+		opts, err := newInspectOptions(opt...)
+		if err != nil {
+			return nil, err
+		}
+		r, err := cloneGitRepository(
+			ctx, loc.GitRepositoryURL(), loc.GitChartPath(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		defer r.close()
+		lc, err := r.load(ctx, loc.GitRef(), version, opts)
+		if err != nil {
+			return nil, err
+		}
+		lc.origin.Location = loc
+		return newChart(ctx, lc, r.chartDir(), opts)
+	}
+	opts, err := newInspectOptions(opt...)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("non-ok read from %q: %d", url, resp.StatusCode)
+	httpOpts := &opts.http
+	if loc.repoEntry != nil {
+		httpOpts = opts.http.withRepositoryConfig(loc.repoEntry)
+	}
+	lc, err := fetchHelmRepositoryChart(
+		ctx, loc.HelmRepositoryURL(), loc.Name, version, httpOpts, opts,
+	)
+	if err != nil {
+		return nil, err
 	}
+	lc.origin.SubjectType = SubjectTypeHelmRepository
+	lc.origin.Location = loc
+	return newChart(ctx, lc, "", opts)
+}
 
-	f, err := os.CreateTemp("", filepath.Base(url))
+// newInspectOptions returns the InspectOptions resulting from applying the
+// supplied InspectOption functions to the default options.
+func newInspectOptions(opt ...InspectOption) (*InspectOptions, error) {
+	opts := defaultInspectOptions()
+	for _, o := range opt {
+		o(opts)
+	}
+	if opts.offline && opts.cacheDir == "" {
+		return nil, fmt.Errorf("WithOffline() requires WithCacheDir()")
+	}
+	var err error
+	opts.values, err = opts.mergeValues()
 	if err != nil {
 		return nil, err
 	}
-	io.Copy(f, resp.Body)
-	f.Seek(0, 0)
-	return f, nil
+	return opts, nil
 }
 
-// fetchOCI pulls the a Helm Chart OCI artifact from the supplied OCI
-// repository URL. It returns the local directory containing the pulled and
-// untarred Helm Chart. Callers are responsible for cleaning up this directory.
-func fetchOCI(
+// newChart returns a Chart for the supplied loaded Helm Chart, resolving any
+// missing dependencies if requested. The chartDir argument is the directory
+// containing the unpacked Helm Chart, if any.
+func newChart(
 	ctx context.Context,
-	repoURL string,
-	chartVersion string,
-	registryClient *registry.Client,
-) (string, error) {
-	ctx = debug.PushTrace(ctx, "helm:fetch-oci")
-	defer debug.PopTrace(ctx)
-	untarDir, err := os.MkdirTemp("", "kube-inspect-oci-pull")
+	lc *loadedChart,
+	chartDir string,
+	opts *InspectOptions,
+) (*Chart, error) {
+	hc := lc.chart
+	if opts.resolveDependencies {
+		var err error
+		hc, err = resolveDependencies(ctx, hc, chartDir, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if hc.Metadata != nil {
+		lc.origin.Version = hc.Metadata.Version
+	}
+	return &Chart{
+		Chart:        hc,
+		inspectOpts:  opts,
+		origin:       lc.origin,
+		verification: lc.verification,
+	}, nil
+}
+
+// loadPath loads the Helm Chart from the unpacked Helm Chart directory or
+// Helm Chart archive at the supplied path. If a keyring was supplied with
+// WithKeyring(), the Helm Chart archive is verified using the provenance file
+// alongside it.
+func loadPath(
+	ctx context.Context,
+	path string,
+	opts *InspectOptions,
+) (*loadedChart, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	origin := &Origin{
+		Location: &ChartLocation{URL: "file://" + absPath},
+		URL:      path,
+	}
+	if fi.IsDir() {
+		if opts.keyring != "" {
+			return nil, fmt.Errorf(
+				"cannot verify unpacked chart directory %s", path,
+			)
+		}
+		hc, err := loader.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		origin.SubjectType = SubjectTypeDirectory
+		return &loadedChart{chart: hc, origin: origin}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	hc, err := loadArchiveData(data)
 	if err != nil {
-		return "", fmt.Errorf("failed to create untar dir: %w", err)
+		return nil, err
+	}
+	origin.SubjectType = SubjectTypeArchive
+	origin.Digest = digestOf(data)
+	lc := &loadedChart{chart: hc, origin: origin}
+	if opts.keyring != "" {
+		prov, err := os.ReadFile(path + ".prov")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read provenance file: %w", err)
+		}
+		lc.verification, err = verifyArchiveData(
+			ctx, data, filepath.Base(path), prov, opts.keyring,
+		)
+		if err != nil {
+			return nil, err
+		}
 	}
-	debug.Printf(ctx, "created untar dir %s", untarDir)
+	return lc, nil
+}
 
-	settings := cli.New()
-	cfg := &action.Configuration{}
-	err = cfg.Init(
-		settings.RESTClientGetter(),
-		settings.Namespace(),
-		os.Getenv("HELM_DRIVER"),
-		log.Printf,
+// loadArchiveURL returns the Helm Chart in the tarball at the supplied URL,
+// using the chart cache if enabled and the supplied httpOptions otherwise.
+// The digest argument is the SHA-256 digest of the tarball, if known.
+//
+// If a keyring was supplied with WithKeyring(), the Helm Chart's provenance
+// file is fetched from the same URL with a ".prov" suffix and the Helm Chart
+// is verified against the keyring.
+func loadArchiveURL(
+	ctx context.Context,
+	archiveURL string,
+	digest string,
+	httpOpts *httpOptions,
+	opts *InspectOptions,
+) (*loadedChart, error) {
+	cache := opts.chartCache()
+	key := cacheKey{url: archiveURL, digest: digest}
+	path, ok := cache.get(ctx, key)
+	if !ok {
+		if err := cache.checkOnline(archiveURL); err != nil {
+			return nil, err
+		}
+		tf, err := fetchArchive(ctx, archiveURL, httpOpts)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(tf.Name())
+		defer tf.Close()
+		if _, err := cache.put(ctx, key, tf); err != nil {
+			return nil, err
+		}
+		path = tf.Name()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	hc, err := loadArchiveData(data)
+	if err != nil {
+		return nil, err
+	}
+	lc := &loadedChart{
+		chart: hc,
+		origin: &Origin{
+			SubjectType: SubjectTypeURL,
+			URL:         archiveURL,
+			Digest:      digestOf(data),
+		},
+	}
+	if opts.keyring == "" {
+		return lc, nil
+	}
+	u, err := url.Parse(archiveURL)
+	if err != nil {
+		return nil, err
+	}
+	fileName := filepath.Base(u.Path)
+	u.Path += ".prov"
+	prov, err := fetchCached(ctx, u.String(), httpOpts, cache)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch provenance file: %w", err)
+	}
+	lc.verification, err = verifyArchiveData(
+		ctx, data, fileName, prov, opts.keyring,
 	)
 	if err != nil {
-		return "", fmt.Errorf("failed to init action config: %w", err)
-	}
-	pull := action.NewPullWithOpts(action.WithConfig(cfg))
-	pull.Settings = settings
-	pull.Version = chartVersion
-	pull.UntarDir = untarDir
-	pull.Untar = true
-	pull.SetRegistryClient(registryClient)
+		return nil, err
+	}
+	return lc, nil
+}
 
-	_, err = pull.Run(repoURL)
+// loadArchiveData returns the Helm Chart in the supplied tarball content.
+func loadArchiveData(data []byte) (*helmchart.Chart, error) {
+	hc, err := loader.LoadArchive(bytes.NewReader(data))
 	if err != nil {
-		os.RemoveAll(untarDir)
-		return "", fmt.Errorf("failed to pull chart: %w", err)
+		return nil, fmt.Errorf("error loading archive: %w", err)
 	}
-	return untarDir, nil
+	return hc, nil
 }
 
-// firstDir returns the path to the first (sub)directory in the supplied path.
-func firstDir(dir string) (string, error) {
-	entries, err := os.ReadDir(dir)
+// fetchArchive reads the tarball at the supplied URL, copies it to a temporary
+// file and returns the temporary file. callers are responsible for removing
+// the temporary file.
+func fetchArchive(
+	ctx context.Context,
+	url string,
+	httpOpts *httpOptions,
+) (*os.File, error) {
+	ctx = debug.PushTrace(ctx, "helm:fetch-archive")
+	defer debug.PopTrace(ctx)
+	resp, err := httpOpts.get(ctx, url)
 	if err != nil {
-		return "", err
-	}
-	if len(entries) != 1 {
-		return "", fmt.Errorf(
-			"expected single subdirectory but got %d.", len(entries),
-		)
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	for _, v := range entries {
-		if v.IsDir() {
-			return filepath.Join(dir, v.Name()), nil
-		}
+	f, err := os.CreateTemp("", filepath.Base(url))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("failed to read %q: %w", url, err)
 	}
-	return "", fmt.Errorf("single entry in directory was not a directory.")
+	if _, err := f.Seek(0, 0); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
 }
@@ -6,6 +6,7 @@ package helm_test
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -13,9 +14,11 @@ import (
 
 	kictx "github.com/jaypipes/kube-inspect/context"
 	kihelm "github.com/jaypipes/kube-inspect/helm"
+	"github.com/jaypipes/kube-inspect/kube"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"helm.sh/helm/v3/pkg/chart/loader"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 const (
@@ -30,6 +33,7 @@ var (
 	certManager1_18_0_LocalChartPath = filepath.Join("testdata", "cert-manager-v1.18.0.tgz")
 	nginxLocalChartPath              = filepath.Join("testdata", "nginx-8.8.4.tgz")
 	nginxLocalChartDir               = filepath.Join("testdata", "nginx")
+	capabilitiesLocalChartDir        = filepath.Join("testdata", "capabilities")
 )
 
 func skipNetworkFetch(t *testing.T) {
@@ -188,6 +192,29 @@ func TestInspectWithValues(t *testing.T) {
 	assert.Contains(resourceKinds, "ConfigMap")
 }
 
+func TestInspectWithReleaseNameAndNamespace(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	c, err := kihelm.Inspect(
+		ctx, nginxLocalChartDir,
+		kihelm.WithReleaseName("myrel"),
+		kihelm.WithNamespace("prod"),
+		kihelm.WithValues("pdb.create=true"),
+	)
+	require.Nil(err)
+
+	deployments, err := c.Resources(ctx, kube.WithKind("Deployment"))
+	require.Nil(err)
+	require.Len(deployments, 1)
+	assert.Equal("myrel-nginx", deployments[0].GetName())
+
+	pdbs, err := c.Resources(ctx, kube.WithKind("PodDisruptionBudget"))
+	require.Nil(err)
+	require.Len(pdbs, 1)
+	assert.Equal("prod", pdbs[0].GetNamespace())
+}
+
 // When a Helm Chart specifies a KubeVersion constraint that does not meet the
 // "DefaultCapabilities.KubeVersion" set in the Helm SDK Go's chartutil
 // package, we need to detect that and automatically adjust the
@@ -218,3 +245,123 @@ func TestInspectChartAutoAdjustedKubeVersion(t *testing.T) {
 		`manually to "v1.22.0"`
 	assert.Contains(debugContent, expected)
 }
+
+func TestInspectChartSolvedKubeVersion(t *testing.T) {
+	tcs := []struct {
+		name       string
+		constraint string
+		expVersion string
+	}{
+		{
+			"compound range",
+			">= 1.22.0-0 < 1.30.0-0",
+			"v1.22.0",
+		},
+		{
+			"union",
+			"< 1.16.0 || >= 1.25.0-0",
+			"v1.25.0",
+		},
+		{
+			"upper bound below default",
+			">= 1.14, < 1.19",
+			"v1.18.0",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(tt *testing.T) {
+			require := require.New(tt)
+			assert := assert.New(tt)
+			debugCollector := &strings.Builder{}
+			hc, err := loader.Load(nginxLocalChartDir)
+			require.Nil(err)
+			hc.Metadata.KubeVersion = tc.constraint
+			ctx := kictx.New(kictx.WithDebug(debugCollector))
+			c, err := kihelm.Inspect(ctx, hc)
+			require.Nil(err)
+			_, err = c.Resources(ctx)
+			require.Nil(err)
+			expected := fmt.Sprintf(
+				"setting installer.KubeVersion manually to %q",
+				tc.expVersion,
+			)
+			assert.Contains(debugCollector.String(), expected)
+		})
+	}
+}
+
+func TestInspectWithCapabilities(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+
+	c, err := kihelm.Inspect(ctx, capabilitiesLocalChartDir)
+	require.Nil(err)
+	resources, err := c.Resources(ctx)
+	require.Nil(err)
+	assert.Len(resources, 1)
+
+	c, err = kihelm.Inspect(
+		ctx, capabilitiesLocalChartDir,
+		kihelm.WithKubeVersion("1.29.3"),
+		kihelm.WithAPIVersions("monitoring.coreos.com/v1"),
+	)
+	require.Nil(err)
+	resources, err = c.Resources(ctx)
+	require.Nil(err)
+	assert.Len(resources, 2)
+
+	cms, err := c.Resources(ctx, kube.WithKind("ConfigMap"))
+	require.Nil(err)
+	require.Len(cms, 1)
+	ver, _, err := unstructured.NestedString(cms[0].Object, "data", "version")
+	require.Nil(err)
+	assert.Equal("v1.29.3", ver)
+
+	sms, err := c.Resources(ctx, kube.WithKind("ServiceMonitor"))
+	require.Nil(err)
+	assert.Len(sms, 1)
+}
+
+func TestInspectLocation(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	srv := serveHelmRepository(t, "0.1.0", "0.2.0")
+
+	loc, err := kihelm.ChartLocationFromURL(srv.URL + "/child")
+	require.Nil(err)
+
+	c, err := kihelm.InspectLocation(ctx, loc, "0.1.0")
+	require.Nil(err)
+	assert.Equal("child", c.Name())
+	assert.Equal("0.1.0", c.Metadata.Version)
+
+	// An empty version means the latest version in the index file
+	c, err = kihelm.InspectLocation(ctx, loc, "")
+	require.Nil(err)
+	assert.Equal("0.2.0", c.Metadata.Version)
+
+	// Inspect options are applied to the rendered chart
+	c, err = kihelm.InspectLocation(
+		ctx, loc, "0.2.0", kihelm.WithReleaseName("myrelease"),
+	)
+	require.Nil(err)
+	resources, err := c.Resources(ctx)
+	require.Nil(err)
+	require.Len(resources, 1)
+	assert.Equal("myrelease-child", resources[0].GetName())
+
+	_, err = kihelm.InspectLocation(ctx, loc, "9.9.9")
+	require.NotNil(err)
+	assert.ErrorContains(err, "not found")
+
+	loc, err = kihelm.ChartLocationFromURL("file://" + umbrellaLocalChartDir)
+	require.Nil(err)
+	c, err = kihelm.InspectLocation(ctx, loc, "0.1.0")
+	require.Nil(err)
+	assert.Equal("umbrella", c.Name())
+
+	_, err = kihelm.InspectLocation(ctx, loc, "0.2.0")
+	require.NotNil(err)
+}
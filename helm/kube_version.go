@@ -0,0 +1,82 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+var (
+	// constraintVersionRegex matches the version operands in a SemVer
+	// constraint string, e.g. "1.22.0-0" and "1.30" in ">= 1.22.0-0 < 1.30".
+	// Any pre-release suffix is consumed (but not captured) so that it is not
+	// mistaken for a separate version operand.
+	constraintVersionRegex = regexp.MustCompile(
+		`v?(\d+)(?:\.(\d+|[xX*]))?(?:\.(\d+|[xX*]))?(?:-[0-9A-Za-z.-]+)?`,
+	)
+)
+
+// solveKubeVersion returns a Kubernetes version that satisfies the supplied
+// KubeVersion constraint. The constraint may contain compound ranges (e.g.
+// ">= 1.22.0-0 < 1.30.0-0") and "||" unions.
+//
+// Candidate versions are derived from the version operands in the constraint
+// (the operand itself along with its neighbouring minor and patch versions).
+// Of the candidates that satisfy the constraint, the one closest to the
+// supplied default version is returned: the lowest candidate greater than the
+// default or, if there are none, the highest candidate lower than the default.
+func solveKubeVersion(
+	constraint string,
+	vc *semver.Constraints,
+	def *semver.Version,
+) (*semver.Version, error) {
+	candidates := semver.Collection{}
+	for _, m := range constraintVersionRegex.FindAllStringSubmatch(constraint, -1) {
+		major, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		// wildcards and missing parts are treated as zero
+		minor, _ := strconv.ParseUint(m[2], 10, 64)
+		patch, _ := strconv.ParseUint(m[3], 10, 64)
+		candidates = append(
+			candidates,
+			semver.New(major, minor, patch, "", ""),
+			semver.New(major, minor+1, 0, "", ""),
+		)
+		if minor > 0 {
+			candidates = append(
+				candidates, semver.New(major, minor-1, 0, "", ""),
+			)
+		}
+		if patch > 0 {
+			candidates = append(
+				candidates, semver.New(major, minor, patch-1, "", ""),
+			)
+		}
+	}
+	sort.Sort(candidates)
+	var below *semver.Version
+	for _, cv := range candidates {
+		if !vc.Check(cv) {
+			continue
+		}
+		if def == nil || cv.GreaterThan(def) {
+			return cv, nil
+		}
+		below = cv
+	}
+	if below != nil {
+		return below, nil
+	}
+	return nil, fmt.Errorf(
+		"unable to find a kube version satisfying constraint %q", constraint,
+	)
+}
@@ -0,0 +1,177 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	helmchartutil "helm.sh/helm/v3/pkg/chartutil"
+
+	"github.com/jaypipes/kube-inspect/debug"
+)
+
+// ChartVersionsWithChartName returns a ChartVersionsOption that only includes
+// versions of the Helm Chart with the supplied name. Required when reading a
+// directory containing Helm Chart archives of multiple Helm Charts with
+// ChartVersionsFromLocalPath().
+func ChartVersionsWithChartName(name string) ChartVersionsOption {
+	return func(o *ChartVersionsOptions) {
+		o.chartName = name
+	}
+}
+
+// ChartVersionsFromLocalPath returns a slice of `ChartVersion` structs
+// describing the Helm Chart at the supplied local filesystem path. The path
+// may refer to an unpacked Helm Chart directory, a Helm Chart archive or a
+// directory containing multiple Helm Chart archives (files with a ".tgz"
+// suffix), e.g. the output of multiple calls to `helm package`. If the
+// directory contains Helm Chart archives of multiple Helm Charts, the Helm
+// Chart must be selected with ChartVersionsWithChartName().
+func ChartVersionsFromLocalPath(
+	ctx context.Context,
+	path string,
+	opt ...ChartVersionsOption,
+) ([]*ChartVersion, error) {
+	ctx = debug.PushTrace(ctx, "helm:chart-versions-local")
+	defer debug.PopTrace(ctx)
+	opts := defaultChartVersionsOptions()
+	for _, o := range opt {
+		o(opts)
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	out := []*ChartVersion{}
+	if ok, _ := helmchartutil.IsChartDir(path); ok {
+		md, err := helmchartutil.LoadChartfile(
+			filepath.Join(path, helmchartutil.ChartfileName),
+		)
+		if err != nil {
+			return nil, err
+		}
+		cv, err := chartVersionFromMetadata(md)
+		if err != nil {
+			return nil, err
+		}
+		if opts.includeChart(md.Name) && opts.include(cv) {
+			out = append(out, cv)
+		}
+		return out, nil
+	}
+	archives := []string{path}
+	if fi.IsDir() {
+		archives, err = filepath.Glob(filepath.Join(path, "*.tgz"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	names := map[string]bool{}
+	for _, archive := range archives {
+		cv, name, err := localArchiveChartVersion(archive)
+		if err != nil {
+			// A single archive must be a valid Helm Chart, but a directory
+			// may contain other archives.
+			if !fi.IsDir() {
+				return nil, err
+			}
+			msg := fmt.Sprintf("skipping %s: %s\n", archive, err)
+			opts.errorCollector.Write([]byte(msg)) // nolint:errcheck
+			continue
+		}
+		if !opts.includeChart(name) {
+			continue
+		}
+		names[name] = true
+		if opts.include(cv) {
+			out = append(out, cv)
+		}
+	}
+	if len(names) > 1 {
+		return nil, fmt.Errorf(
+			"%s contains archives of multiple charts (%s), "+
+				"a chart name is required",
+			path, strings.Join(slices.Sorted(maps.Keys(names)), ", "),
+		)
+	}
+	debug.Printf(ctx, "found %d chart versions in %s\n", len(out), path)
+	return opts.sortAndLimit(out), nil
+}
+
+// includeChart returns true if the supplied Helm Chart name matches the name
+// supplied with ChartVersionsWithChartName().
+func (o *ChartVersionsOptions) includeChart(name string) bool {
+	return o.chartName == "" || o.chartName == name
+}
+
+// localArchiveChartVersion returns a ChartVersion describing the Helm Chart
+// archive at the supplied path, along with the Helm Chart's name.
+func localArchiveChartVersion(path string) (*ChartVersion, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	hc, err := loadArchiveData(data)
+	if err != nil {
+		return nil, "", err
+	}
+	cv, err := chartVersionFromMetadata(hc.Metadata)
+	if err != nil {
+		return nil, "", err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, "", err
+	}
+	cv.Digest = digestOf(data)
+	cv.URLs = []string{"file://" + absPath}
+	return cv, hc.Name(), nil
+}
+
+// localArchivePath returns the path of the Helm Chart archive of the named
+// Helm Chart (if a name is supplied) with the supplied version in the
+// supplied directory of Helm Chart archives. If the supplied version is
+// empty, the path of the Helm Chart archive with the highest version is
+// returned.
+func localArchivePath(
+	ctx context.Context,
+	dir string,
+	name string,
+	version string,
+) (string, error) {
+	opt := []ChartVersionsOption{
+		ChartVersionsWithLimit(1),
+		ChartVersionsWithChartName(name),
+	}
+	if version != "" {
+		opt = append(opt, ChartVersionsWithFilter(
+			func(cv *ChartVersion, _ int) bool {
+				return cv.Version == version
+			},
+		))
+	}
+	vers, err := ChartVersionsFromLocalPath(ctx, dir, opt...)
+	if err != nil {
+		return "", err
+	}
+	if len(vers) == 0 {
+		if version == "" {
+			return "", fmt.Errorf("no chart archives found in %s", dir)
+		}
+		return "", fmt.Errorf(
+			"chart archive with version %q not found in %s", version, dir,
+		)
+	}
+	return strings.TrimPrefix(vers[0].URLs[0], "file://"), nil
+}
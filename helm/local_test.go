@@ -0,0 +1,114 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	kihelm "github.com/jaypipes/kube-inspect/helm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	helmchartutil "helm.sh/helm/v3/pkg/chartutil"
+)
+
+func TestChartVersionsFromLocalPath(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	dir := writeHelmRepository(t, "0.1.0", "0.2.0", "0.10.0")
+	junk := filepath.Join(dir, "junk.tgz")
+	require.Nil(os.WriteFile(junk, []byte("not a chart"), 0o644))
+
+	loc, err := kihelm.ChartLocationFromURL("file://" + dir)
+	require.Nil(err)
+	errs := &strings.Builder{}
+	vers, err := kihelm.ChartVersionsFromLocation(
+		ctx, loc, kihelm.ChartVersionsWithErrorCollector(errs),
+	)
+	require.Nil(err)
+	assert.Equal(
+		[]string{"0.10.0", "0.2.0", "0.1.0"}, chartVersionStrings(vers),
+	)
+	archive := filepath.Join(dir, "child-0.2.0.tgz")
+	assert.Equal(fileDigest(t, archive), vers[1].Digest)
+	assert.Equal([]string{"file://" + archive}, vers[1].URLs)
+	assert.Contains(errs.String(), "junk.tgz")
+
+	vers, err = kihelm.ChartVersionsFromLocalPath(ctx, archive)
+	require.Nil(err)
+	assert.Equal([]string{"0.2.0"}, chartVersionStrings(vers))
+
+	_, err = kihelm.ChartVersionsFromLocalPath(ctx, junk)
+	assert.NotNil(err)
+
+	vers, err = kihelm.ChartVersionsFromLocalPath(ctx, umbrellaLocalChartDir)
+	require.Nil(err)
+	assert.Equal([]string{"0.1.0"}, chartVersionStrings(vers))
+}
+
+func TestInspectLocationLocalArchives(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	dir := writeHelmRepository(t, "0.1.0", "0.2.0")
+	loc, err := kihelm.ChartLocationFromURL("file://" + dir)
+	require.Nil(err)
+
+	c, err := kihelm.InspectLocation(ctx, loc, "")
+	require.Nil(err)
+	assert.Equal("0.2.0", c.Metadata.Version)
+	assert.Equal(kihelm.SubjectTypeArchive, c.Origin().SubjectType)
+	assert.Equal(loc, c.Origin().Location)
+
+	c, err = kihelm.InspectLocation(ctx, loc, "0.1.0")
+	require.Nil(err)
+	assert.Equal("0.1.0", c.Metadata.Version)
+
+	_, err = kihelm.InspectLocation(ctx, loc, "9.9.9")
+	assert.NotNil(err)
+}
+
+func TestChartVersionsFromLocalPathMultipleCharts(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	dir := writeHelmRepository(t, "0.1.0", "0.2.0")
+	other := &helmchart.Chart{
+		Metadata: &helmchart.Metadata{
+			APIVersion: helmchart.APIVersionV2,
+			Name:       "other",
+			Version:    "9.9.9",
+		},
+	}
+	_, err := helmchartutil.Save(other, dir)
+	require.Nil(err)
+
+	loc, err := kihelm.ChartLocationFromURL("file://" + dir)
+	require.Nil(err)
+	_, err = kihelm.ChartVersionsFromLocation(ctx, loc)
+	require.NotNil(err)
+	assert.Contains(err.Error(), "multiple charts (child, other)")
+
+	loc.Name = "child"
+	vers, err := kihelm.ChartVersionsFromLocation(ctx, loc)
+	require.Nil(err)
+	assert.Equal([]string{"0.2.0", "0.1.0"}, chartVersionStrings(vers))
+
+	c, err := kihelm.InspectLocation(ctx, loc, "")
+	require.Nil(err)
+	assert.Equal("child", c.Name())
+	assert.Equal("0.2.0", c.Metadata.Version)
+
+	vers, err = kihelm.ChartVersionsFromLocalPath(
+		ctx, dir, kihelm.ChartVersionsWithChartName("other"),
+	)
+	require.Nil(err)
+	assert.Equal([]string{"9.9.9"}, chartVersionStrings(vers))
+}
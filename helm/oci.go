@@ -0,0 +1,329 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"helm.sh/helm/v3/pkg/registry"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/registry/remote"
+
+	"github.com/jaypipes/kube-inspect/debug"
+)
+
+// ociArtifact is the content of a pulled Helm Chart OCI artifact.
+type ociArtifact struct {
+	// chart is the Helm Chart archive.
+	chart []byte
+	// chartDigest is the digest of the Helm Chart archive layer.
+	chartDigest string
+	// manifest is the OCI manifest. Not populated on a cache hit.
+	manifest []byte
+	// manifestDigest is the digest of the OCI manifest.
+	manifestDigest string
+	// prov is the provenance file, if pulled.
+	prov []byte
+}
+
+// loadOCI pulls the Helm Chart OCI artifact with the supplied tag or OCI
+// manifest digest from the supplied OCI repository URL, using the chart cache
+// if enabled. If a keyring was supplied with WithKeyring(), the Helm Chart's
+// provenance file is also pulled and the Helm Chart is verified against the
+// keyring.
+func loadOCI(
+	ctx context.Context,
+	repoURL string,
+	chartVersion string,
+	opts *InspectOptions,
+) (*loadedChart, error) {
+	ctx = debug.PushTrace(ctx, "helm:load-oci")
+	defer debug.PopTrace(ctx)
+	loc, err := ChartLocationFromURL(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	withProv := opts.keyring != ""
+	cache := opts.chartCache()
+	art, ok := cache.getOCI(ctx, repoURL, chartVersion, withProv)
+	if !ok {
+		ref := ociReference(repoURL, chartVersion)
+		if err := cache.checkOnline(ref); err != nil {
+			return nil, err
+		}
+		if opts.registryClient != nil {
+			art, err = pullOCIWithRegistryClient(
+				ctx, repoURL, chartVersion, opts.registryClient, withProv,
+			)
+		} else {
+			repo, rerr := loc.OCIRepository(opts.oci...)
+			if rerr != nil {
+				return nil, fmt.Errorf(
+					"failed to create OCI repository client: %w", rerr,
+				)
+			}
+			art, err = pullOCI(ctx, repo, chartVersion, withProv)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := cache.putOCI(ctx, repoURL, chartVersion, art); err != nil {
+			return nil, err
+		}
+	}
+	hc, err := loadArchiveData(art.chart)
+	if err != nil {
+		return nil, err
+	}
+	lc := &loadedChart{
+		chart: hc,
+		origin: &Origin{
+			SubjectType:       SubjectTypeOCI,
+			Location:          loc,
+			URL:               ociReference(repoURL, chartVersion),
+			Digest:            art.chartDigest,
+			OCIManifestDigest: art.manifestDigest,
+		},
+	}
+	if withProv {
+		fileName := fmt.Sprintf("%s-%s.tgz", hc.Name(), hc.Metadata.Version)
+		v, err := verifyArchiveData(
+			ctx, art.chart, fileName, art.prov, opts.keyring,
+		)
+		if err != nil {
+			return nil, err
+		}
+		v.Digest = art.chartDigest
+		lc.verification = v
+	}
+	return lc, nil
+}
+
+// pullOCI pulls the Helm Chart OCI artifact with the supplied tag or OCI
+// manifest digest from the supplied OCI repository. The Helm Chart archive
+// layer (and provenance layer, if requested) is read into memory and verified
+// against the digest in the OCI manifest.
+func pullOCI(
+	ctx context.Context,
+	repo *remote.Repository,
+	chartVersion string,
+	withProv bool,
+) (*ociArtifact, error) {
+	ctx = debug.PushTrace(ctx, "helm:pull-oci")
+	defer debug.PopTrace(ctx)
+	ref := ociReference(repo.Reference.String(), chartVersion)
+	desc, rc, err := repo.FetchReference(ctx, chartVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull chart %s: %w", ref, err)
+	}
+	defer rc.Close()
+	manifestData, err := content.ReadAll(rc, desc)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to read OCI manifest for %s: %w", ref, err,
+		)
+	}
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf(
+			"failed to unmarshal OCI manifest for %s: %w", ref, err,
+		)
+	}
+	if manifest.Config.MediaType != registry.ConfigMediaType {
+		return nil, fmt.Errorf(
+			"%s is not a Helm Chart OCI artifact: unexpected config media "+
+				"type %q", ref, manifest.Config.MediaType,
+		)
+	}
+	var chartLayer, provLayer *ocispec.Descriptor
+	for x, layer := range manifest.Layers {
+		switch layer.MediaType {
+		case registry.ChartLayerMediaType, registry.LegacyChartLayerMediaType:
+			chartLayer = &manifest.Layers[x]
+		case registry.ProvLayerMediaType:
+			provLayer = &manifest.Layers[x]
+		}
+	}
+	if chartLayer == nil {
+		return nil, fmt.Errorf("no Helm Chart layer found in %s", ref)
+	}
+	// content.FetchAll verifies the size and digest of the fetched content.
+	chart, err := content.FetchAll(ctx, repo, *chartLayer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull chart %s: %w", ref, err)
+	}
+	debug.Printf(ctx, "pulled %s (manifest %s)\n", ref, desc.Digest)
+	art := &ociArtifact{
+		chart:          chart,
+		chartDigest:    chartLayer.Digest.String(),
+		manifest:       manifestData,
+		manifestDigest: desc.Digest.String(),
+	}
+	if withProv {
+		if provLayer == nil {
+			return nil, fmt.Errorf("no provenance layer found in %s", ref)
+		}
+		art.prov, err = content.FetchAll(ctx, repo, *provLayer)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to pull provenance file for %s: %w", ref, err,
+			)
+		}
+	}
+	return art, nil
+}
+
+// pullOCIWithRegistryClient pulls the Helm Chart OCI artifact with the
+// supplied tag or OCI manifest digest from the supplied OCI repository URL
+// using the supplied Helm registry client and verifies the digest of the Helm
+// Chart archive layer.
+func pullOCIWithRegistryClient(
+	ctx context.Context,
+	repoURL string,
+	chartVersion string,
+	registryClient *registry.Client,
+	withProv bool,
+) (*ociArtifact, error) {
+	ctx = debug.PushTrace(ctx, "helm:pull-oci")
+	defer debug.PopTrace(ctx)
+	ref := ociReference(strings.TrimPrefix(repoURL, "oci://"), chartVersion)
+	res, err := registryClient.Pull(ref, registry.PullOptWithProv(withProv))
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull chart: %w", err)
+	}
+	digest := digestOf(res.Chart.Data)
+	if res.Chart.Digest != digest {
+		return nil, fmt.Errorf(
+			"digest mismatch for %s: expected %s but got %s",
+			ref, res.Chart.Digest, digest,
+		)
+	}
+	debug.Printf(ctx, "pulled %s (manifest %s)\n", ref, res.Manifest.Digest)
+	art := &ociArtifact{
+		chart:          res.Chart.Data,
+		chartDigest:    digest,
+		manifest:       res.Manifest.Data,
+		manifestDigest: res.Manifest.Digest,
+	}
+	if withProv {
+		art.prov = res.Prov.Data
+	}
+	return art, nil
+}
+
+// splitOCIReference splits the supplied OCI URL into the OCI repository URL
+// and the tag or OCI manifest digest, if any. For example,
+// "oci://quay.io/charts/child:1.2.3" is split into "oci://quay.io/charts/child"
+// and "1.2.3", and "oci://quay.io/charts/child@sha256:1a2b..." is split into
+// "oci://quay.io/charts/child" and "sha256:1a2b...".
+func splitOCIReference(url string) (string, string) {
+	if repoURL, digest, ok := strings.Cut(url, "@"); ok {
+		return repoURL, digest
+	}
+	// A colon before the last slash separates the registry host and port.
+	slash := strings.LastIndex(url, "/")
+	if colon := strings.LastIndex(url, ":"); colon > slash {
+		return url[:colon], url[colon+1:]
+	}
+	return url, ""
+}
+
+// ociReference returns the OCI reference to the supplied tag or OCI manifest
+// digest in the supplied OCI repository. Tags cannot contain colons, so a
+// reference containing a colon is a digest.
+func ociReference(repo string, ref string) string {
+	if strings.Contains(ref, ":") {
+		return repo + "@" + ref
+	}
+	return repo + ":" + ref
+}
+
+// ociCacheKeys returns the cache keys for the Helm Chart archive, OCI
+// manifest and provenance file of the Helm Chart OCI artifact with the
+// supplied tag in the supplied OCI repository.
+func ociCacheKeys(repoURL string, chartVersion string) (cacheKey, cacheKey, cacheKey) {
+	return cacheKey{url: repoURL, version: chartVersion},
+		cacheKey{url: repoURL + "#manifest", version: chartVersion},
+		cacheKey{url: repoURL + "#prov", version: chartVersion}
+}
+
+// getOCI returns the cached content of the Helm Chart OCI artifact with the
+// supplied tag in the supplied OCI repository, or false if it is not cached.
+// Safe to call on a nil chartCache.
+//
+// The OCI manifest itself is cached so that, since the cache is content
+// addressed, its digest is known on a cache hit.
+func (c *chartCache) getOCI(
+	ctx context.Context,
+	repoURL string,
+	chartVersion string,
+	withProv bool,
+) (*ociArtifact, bool) {
+	if c == nil {
+		return nil, false
+	}
+	chartKey, manifestKey, provKey := ociCacheKeys(repoURL, chartVersion)
+	chartPath, ok := c.get(ctx, chartKey)
+	if !ok {
+		return nil, false
+	}
+	manifestPath, ok := c.get(ctx, manifestKey)
+	if !ok {
+		return nil, false
+	}
+	data, err := os.ReadFile(chartPath)
+	if err != nil {
+		return nil, false
+	}
+	art := &ociArtifact{
+		chart:          data,
+		chartDigest:    "sha256:" + filepath.Base(chartPath),
+		manifestDigest: "sha256:" + filepath.Base(manifestPath),
+	}
+	if withProv {
+		provPath, ok := c.get(ctx, provKey)
+		if !ok {
+			return nil, false
+		}
+		art.prov, err = os.ReadFile(provPath)
+		if err != nil {
+			return nil, false
+		}
+	}
+	return art, true
+}
+
+// putOCI stores the content of the supplied Helm Chart OCI artifact in the
+// cache. Safe to call on a nil chartCache.
+func (c *chartCache) putOCI(
+	ctx context.Context,
+	repoURL string,
+	chartVersion string,
+	art *ociArtifact,
+) error {
+	if c == nil {
+		return nil
+	}
+	chartKey, manifestKey, provKey := ociCacheKeys(repoURL, chartVersion)
+	if _, err := c.put(ctx, chartKey, bytes.NewReader(art.chart)); err != nil {
+		return err
+	}
+	if _, err := c.put(ctx, manifestKey, bytes.NewReader(art.manifest)); err != nil {
+		return err
+	}
+	if art.prov != nil {
+		if _, err := c.put(ctx, provKey, bytes.NewReader(art.prov)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
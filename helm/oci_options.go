@@ -0,0 +1,220 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm
+
+import (
+	"context"
+	"net/http"
+
+	"helm.sh/helm/v3/pkg/cli"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/credentials"
+)
+
+// ociOptions controls the connections made to OCI registries.
+type ociOptions struct {
+	// username and password are static credentials for the OCI registry.
+	username string
+	password string
+	// bearerToken is a static access token for the OCI registry.
+	bearerToken string
+	// credentialsFile is the path to a Docker-style credentials file, e.g.
+	// `~/.docker/config.json`.
+	credentialsFile string
+	// plainHTTP connects to the OCI registry over HTTP instead of HTTPS.
+	plainHTTP bool
+	// insecureSkipTLSVerify skips verification of the OCI registry's TLS
+	// certificate.
+	insecureSkipTLSVerify bool
+	// caFile is the path to a PEM-encoded bundle of CA certificates used to
+	// verify the OCI registry's TLS certificate, in addition to the system's
+	// CA certificates.
+	caFile string
+	// certFile and keyFile are the paths to a PEM-encoded TLS client
+	// certificate and key.
+	certFile string
+	keyFile  string
+}
+
+// OCIOption modifies the connections made to OCI registries. OCIOptions are
+// supplied to ChartLocation.OCIRepository(), or using WithOCIOptions() or
+// ChartVersionsWithOCIOptions().
+type OCIOption func(*ociOptions)
+
+// OCIWithBasicAuth returns an OCIOption that authenticates to the OCI
+// registry with the supplied username and password instead of credentials
+// from a credentials store.
+func OCIWithBasicAuth(username, password string) OCIOption {
+	return func(o *ociOptions) {
+		o.username = username
+		o.password = password
+	}
+}
+
+// OCIWithBearerToken returns an OCIOption that authenticates to the OCI
+// registry with the supplied access token instead of credentials from a
+// credentials store.
+func OCIWithBearerToken(token string) OCIOption {
+	return func(o *ociOptions) {
+		o.bearerToken = token
+	}
+}
+
+// OCIWithCredentialsFile returns an OCIOption that reads credentials for the
+// OCI registry from the Docker-style credentials file (e.g. as written by
+// `docker login` or `helm registry login`) at the supplied path. By default,
+// credentials are read from the Docker credentials store, falling back to the
+// helm CLI's registry configuration.
+func OCIWithCredentialsFile(path string) OCIOption {
+	return func(o *ociOptions) {
+		o.credentialsFile = path
+	}
+}
+
+// OCIWithPlainHTTP returns an OCIOption that connects to the OCI registry
+// over plain HTTP instead of HTTPS, e.g. for a local `registry:2` container.
+func OCIWithPlainHTTP() OCIOption {
+	return func(o *ociOptions) {
+		o.plainHTTP = true
+	}
+}
+
+// OCIWithInsecureSkipTLSVerify returns an OCIOption that skips verification
+// of the OCI registry's TLS certificate.
+func OCIWithInsecureSkipTLSVerify() OCIOption {
+	return func(o *ociOptions) {
+		o.insecureSkipTLSVerify = true
+	}
+}
+
+// OCIWithCAFile returns an OCIOption that sets the path to a PEM-encoded
+// bundle of CA certificates used to verify the OCI registry's TLS
+// certificate. The CA certificates are used in addition to the system's CA
+// certificates.
+func OCIWithCAFile(path string) OCIOption {
+	return func(o *ociOptions) {
+		o.caFile = path
+	}
+}
+
+// OCIWithClientCertificate returns an OCIOption that authenticates to the OCI
+// registry with the PEM-encoded TLS client certificate and key at the
+// supplied paths.
+func OCIWithClientCertificate(certFile, keyFile string) OCIOption {
+	return func(o *ociOptions) {
+		o.certFile = certFile
+		o.keyFile = keyFile
+	}
+}
+
+// WithOCIOptions returns an InspectOption that applies the supplied OCIOptions
+// when pulling Helm Charts (including dependencies) from OCI registries, if
+// WithRegistryClient() is not supplied.
+func WithOCIOptions(opt ...OCIOption) InspectOption {
+	return func(opts *InspectOptions) {
+		opts.oci = append(opts.oci, opt...)
+	}
+}
+
+// ChartVersionsWithOCIOptions returns a ChartVersionsOption that applies the
+// supplied OCIOptions when listing chart versions from OCI registries with
+// ChartVersionsFromLocation().
+func ChartVersionsWithOCIOptions(opt ...OCIOption) ChartVersionsOption {
+	return func(o *ChartVersionsOptions) {
+		o.oci = append(o.oci, opt...)
+	}
+}
+
+// newOCIOptions returns the ociOptions resulting from applying the supplied
+// OCIOption functions.
+func newOCIOptions(opt ...OCIOption) *ociOptions {
+	o := &ociOptions{}
+	for _, fn := range opt {
+		fn(o)
+	}
+	return o
+}
+
+// httpClient returns the HTTP client to use for requests to the OCI registry,
+// configured with any TLS options.
+func (o *ociOptions) httpClient() (*http.Client, error) {
+	hopts := &httpOptions{
+		caFile:                o.caFile,
+		certFile:              o.certFile,
+		keyFile:               o.keyFile,
+		insecureSkipTLSVerify: o.insecureSkipTLSVerify,
+	}
+	return hopts.httpClient()
+}
+
+// credential returns the function that supplies credentials for the OCI
+// registry.
+func (o *ociOptions) credential() (auth.CredentialFunc, error) {
+	switch {
+	case o.bearerToken != "":
+		return staticCredential(auth.Credential{AccessToken: o.bearerToken}), nil
+	case o.username != "" || o.password != "":
+		return staticCredential(
+			auth.Credential{Username: o.username, Password: o.password},
+		), nil
+	case o.credentialsFile != "":
+		store, err := credentials.NewStore(
+			o.credentialsFile, credentials.StoreOptions{},
+		)
+		if err != nil {
+			return nil, err
+		}
+		return credentials.Credential(store), nil
+	}
+	// Fall back to any credentials stored by `helm registry login`.
+	helmStore, err := credentials.NewStore(
+		cli.New().RegistryConfig, credentials.StoreOptions{},
+	)
+	if err != nil {
+		return nil, err
+	}
+	// The Docker credentials store may be unavailable, e.g. in containers,
+	// in which case only the helm CLI's registry configuration is used.
+	dockerStore, err := credentials.NewStoreFromDocker(credentials.StoreOptions{})
+	if err != nil {
+		return credentials.Credential(helmStore), nil
+	}
+	return credentials.Credential(
+		credentials.NewStoreWithFallbacks(dockerStore, helmStore),
+	), nil
+}
+
+// staticCredential returns a CredentialFunc that supplies the supplied
+// credential for any OCI registry.
+func staticCredential(cred auth.Credential) auth.CredentialFunc {
+	return func(context.Context, string) (auth.Credential, error) {
+		return cred, nil
+	}
+}
+
+// repository returns an ORAS Repository for the OCI repository at the supplied
+// path, e.g. "quay.io/jetstack/charts/cert-manager".
+func (o *ociOptions) repository(path string) (*remote.Repository, error) {
+	repo, err := remote.NewRepository(path)
+	if err != nil {
+		return nil, err
+	}
+	client, err := o.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	cred, err := o.credential()
+	if err != nil {
+		return nil, err
+	}
+	repo.PlainHTTP = o.plainHTTP
+	repo.Client = &auth.Client{
+		Client:     client,
+		Cache:      auth.NewCache(),
+		Credential: cred,
+	}
+	return repo, nil
+}
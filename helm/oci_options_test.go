@@ -0,0 +1,203 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	kihelm "github.com/jaypipes/kube-inspect/helm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// isolateOCICredentials points the Docker and helm CLI credential stores at
+// empty directories so that the user's credentials are not used.
+func isolateOCICredentials(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	t.Setenv(
+		"HELM_REGISTRY_CONFIG", filepath.Join(t.TempDir(), "config.json"),
+	)
+}
+
+// childChartRegistry returns a fakeOCIRegistry serving versions 1.0.0 and
+// 1.0.1 of the "child" chart, along with the 1.0.1 Helm Chart archive.
+func childChartRegistry(t *testing.T) (*fakeOCIRegistry, []byte) {
+	repoDir := writeHelmRepository(t, "1.0.1")
+	archive, err := os.ReadFile(filepath.Join(repoDir, "child-1.0.1.tgz"))
+	require.Nil(t, err)
+	return &fakeOCIRegistry{
+		created: publishedVersions(2),
+		charts:  map[string][]byte{"1.0.1": archive},
+	}, archive
+}
+
+func TestOCIOptionsBasicAuth(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	isolateOCICredentials(t)
+	reg, archive := childChartRegistry(t)
+	reg.authorize = func(req *http.Request) bool {
+		user, pass, ok := req.BasicAuth()
+		return ok && user == testUsername && pass == testPassword
+	}
+	reg.challenge = `Basic realm="fake"`
+	srv := httptest.NewServer(reg)
+	t.Cleanup(srv.Close)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	loc, err := kihelm.ChartLocationFromURL("oci://" + host + "/charts/child")
+	require.Nil(err)
+
+	_, err = kihelm.ChartVersionsFromLocation(
+		ctx, loc, kihelm.ChartVersionsWithOCIOptions(kihelm.OCIWithPlainHTTP()),
+	)
+	require.NotNil(err)
+
+	basicAuth := []kihelm.OCIOption{
+		kihelm.OCIWithPlainHTTP(),
+		kihelm.OCIWithBasicAuth(testUsername, testPassword),
+	}
+	vers, err := kihelm.ChartVersionsFromLocation(
+		ctx, loc, kihelm.ChartVersionsWithOCIOptions(basicAuth...),
+	)
+	require.Nil(err)
+	assert.Equal([]string{"1.0.1", "1.0.0"}, chartVersionStrings(vers))
+
+	c, err := kihelm.Inspect(
+		ctx, loc.URL,
+		kihelm.WithChartVersion("1.0.1"),
+		kihelm.WithOCIOptions(basicAuth...),
+	)
+	require.Nil(err)
+	assert.Equal("1.0.1", c.Metadata.Version)
+	assert.Equal(ociDigest(archive), c.Origin().Digest)
+
+	// Credentials may also be read from a Docker-style credentials file.
+	credsFile := filepath.Join(t.TempDir(), "config.json")
+	creds, err := json.Marshal(map[string]any{
+		"auths": map[string]any{
+			host: map[string]string{
+				"auth": base64.StdEncoding.EncodeToString(
+					[]byte(testUsername + ":" + testPassword),
+				),
+			},
+		},
+	})
+	require.Nil(err)
+	require.Nil(os.WriteFile(credsFile, creds, 0o600))
+	credsFileAuth := []kihelm.OCIOption{
+		kihelm.OCIWithPlainHTTP(),
+		kihelm.OCIWithCredentialsFile(credsFile),
+	}
+	repo, err := loc.OCIRepository(credsFileAuth...)
+	require.Nil(err)
+	vers, err = kihelm.ChartVersionsFromOCIRepository(ctx, repo)
+	require.Nil(err)
+	assert.Len(vers, 2)
+
+	c, err = kihelm.Inspect(
+		ctx, loc.URL,
+		kihelm.WithChartVersion("1.0.1"),
+		kihelm.WithOCIOptions(credsFileAuth...),
+	)
+	require.Nil(err)
+	assert.Equal("1.0.1", c.Metadata.Version)
+}
+
+func TestOCIOptionsBearerToken(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	isolateOCICredentials(t)
+	reg, _ := childChartRegistry(t)
+	reg.authorize = func(req *http.Request) bool {
+		return req.Header.Get("Authorization") == "Bearer "+testBearerToken
+	}
+	srv := httptest.NewServer(reg)
+	t.Cleanup(srv.Close)
+	reg.challenge = `Bearer realm="` + srv.URL + `/token",service="fake"`
+	loc, err := kihelm.ChartLocationFromURL(
+		"oci://" + strings.TrimPrefix(srv.URL, "http://") + "/charts/child",
+	)
+	require.Nil(err)
+
+	bearer := []kihelm.OCIOption{
+		kihelm.OCIWithPlainHTTP(),
+		kihelm.OCIWithBearerToken(testBearerToken),
+	}
+	vers, err := kihelm.ChartVersionsFromLocation(
+		ctx, loc, kihelm.ChartVersionsWithOCIOptions(bearer...),
+	)
+	require.Nil(err)
+	assert.Len(vers, 2)
+
+	c, err := kihelm.Inspect(
+		ctx, loc.URL,
+		kihelm.WithChartVersion("1.0.1"),
+		kihelm.WithOCIOptions(bearer...),
+	)
+	require.Nil(err)
+	assert.Equal("1.0.1", c.Metadata.Version)
+}
+
+func TestOCIOptionsTLS(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	isolateOCICredentials(t)
+	reg, _ := childChartRegistry(t)
+	srv := httptest.NewTLSServer(reg)
+	t.Cleanup(srv.Close)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(
+		&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw},
+	)
+	require.Nil(os.WriteFile(caFile, caPEM, 0o644))
+	loc, err := kihelm.ChartLocationFromURL(
+		"oci://" + strings.TrimPrefix(srv.URL, "https://") + "/charts/child",
+	)
+	require.Nil(err)
+
+	// The registry's certificate is not trusted without the CA file.
+	_, err = kihelm.ChartVersionsFromLocation(ctx, loc)
+	require.NotNil(err)
+	assert.ErrorContains(err, "certificate")
+
+	for _, opt := range []kihelm.OCIOption{
+		kihelm.OCIWithCAFile(caFile),
+		kihelm.OCIWithInsecureSkipTLSVerify(),
+	} {
+		vers, err := kihelm.ChartVersionsFromLocation(
+			ctx, loc, kihelm.ChartVersionsWithOCIOptions(opt),
+		)
+		require.Nil(err)
+		assert.Len(vers, 2)
+	}
+
+	c, err := kihelm.Inspect(
+		ctx, loc.URL,
+		kihelm.WithChartVersion("1.0.1"),
+		kihelm.WithOCIOptions(kihelm.OCIWithCAFile(caFile)),
+	)
+	require.Nil(err)
+	assert.Equal("1.0.1", c.Metadata.Version)
+
+	_, err = kihelm.ChartVersionsFromLocation(
+		ctx, loc,
+		kihelm.ChartVersionsWithOCIOptions(
+			kihelm.OCIWithCAFile(filepath.Join(t.TempDir(), "missing.pem")),
+		),
+	)
+	require.NotNil(err)
+}
@@ -0,0 +1,171 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	kihelm "github.com/jaypipes/kube-inspect/helm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectOCI(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	isolateOCICredentials(t)
+	// Pulling a Helm Chart from an OCI registry must not depend on a
+	// kubeconfig or Helm storage driver.
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "does-not-exist"))
+	t.Setenv("HELM_DRIVER", "unknown")
+	reg, archive := childChartRegistry(t)
+	srv := httptest.NewServer(reg)
+	t.Cleanup(srv.Close)
+	repoURL := "oci://" + strings.TrimPrefix(srv.URL, "http://") + "/charts/child"
+
+	c, err := kihelm.Inspect(
+		ctx, repoURL,
+		kihelm.WithChartVersion("1.0.1"),
+		kihelm.WithOCIOptions(kihelm.OCIWithPlainHTTP()),
+	)
+	require.Nil(err)
+	assert.Equal("child", c.Name())
+	assert.Equal("1.0.1", c.Metadata.Version)
+	res, err := c.Resources(ctx)
+	require.Nil(err)
+	assert.Len(res, 1)
+	manifest, _ := reg.artifact("1.0.1")
+	o := c.Origin()
+	assert.Equal(kihelm.SubjectTypeOCI, o.SubjectType)
+	assert.Equal(repoURL+":1.0.1", o.URL)
+	assert.Equal(ociDigest(archive), o.Digest)
+	assert.Equal(ociDigest(manifest), o.OCIManifestDigest)
+
+	// The chart archive for version 1.0.0 is not served.
+	_, err = kihelm.Inspect(
+		ctx, repoURL,
+		kihelm.WithChartVersion("1.0.0"),
+		kihelm.WithOCIOptions(kihelm.OCIWithPlainHTTP()),
+	)
+	require.NotNil(err)
+
+	_, err = kihelm.Inspect(
+		ctx, repoURL,
+		kihelm.WithChartVersion("9.9.9"),
+		kihelm.WithOCIOptions(kihelm.OCIWithPlainHTTP()),
+	)
+	require.NotNil(err)
+}
+
+func TestInspectOCIReference(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+	isolateOCICredentials(t)
+	reg, archive := childChartRegistry(t)
+	srv := httptest.NewServer(reg)
+	t.Cleanup(srv.Close)
+	repoURL := "oci://" + strings.TrimPrefix(srv.URL, "http://") + "/charts/child"
+	loc, err := kihelm.ChartLocationFromURL(repoURL)
+	require.Nil(err)
+	vers, err := kihelm.ChartVersionsFromLocation(
+		ctx, loc,
+		kihelm.ChartVersionsWithOCIOptions(kihelm.OCIWithPlainHTTP()),
+		kihelm.ChartVersionsWithOCIFetchDetails(),
+	)
+	require.Nil(err)
+	require.Equal("1.0.1", vers[0].Version)
+	digest := vers[0].OCIManifestDigest
+	require.NotEmpty(digest)
+
+	tcs := []struct {
+		name    string
+		url     string
+		version string
+		expURL  string
+		expErr  string
+	}{
+		{"tag", repoURL + ":1.0.1", "", repoURL + ":1.0.1", ""},
+		{"matching tag", repoURL + ":1.0.1", "1.0.1", repoURL + ":1.0.1", ""},
+		{"digest", repoURL + "@" + digest, "", repoURL + "@" + digest, ""},
+		{"digest version", repoURL, digest, repoURL + "@" + digest, ""},
+		{"conflicting tag", repoURL + ":1.0.1", "1.0.0", "", "conflicts"},
+		{"no version", repoURL, "", "", "missing required chart version"},
+		{
+			"unknown digest",
+			repoURL + "@" + ociDigest([]byte("nope")),
+			"",
+			"",
+			"failed to pull chart",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+			assert := assert.New(t)
+			opts := []kihelm.InspectOption{
+				kihelm.WithOCIOptions(kihelm.OCIWithPlainHTTP()),
+			}
+			if tc.version != "" {
+				opts = append(opts, kihelm.WithChartVersion(tc.version))
+			}
+			c, err := kihelm.Inspect(ctx, tc.url, opts...)
+			if tc.expErr != "" {
+				require.NotNil(err)
+				assert.ErrorContains(err, tc.expErr)
+				return
+			}
+			require.Nil(err)
+			assert.Equal("1.0.1", c.Metadata.Version)
+			o := c.Origin()
+			assert.Equal(tc.expURL, o.URL)
+			assert.Equal(repoURL, o.Location.URL)
+			assert.Equal(digest, o.OCIManifestDigest)
+			assert.Equal(ociDigest(archive), o.Digest)
+		})
+	}
+
+	c, err := kihelm.InspectLocation(
+		ctx, loc, digest, kihelm.WithOCIOptions(kihelm.OCIWithPlainHTTP()),
+	)
+	require.Nil(err)
+	require.Equal("1.0.1", c.Origin().Version)
+}
+
+func TestInspectOCIDigestMismatch(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+	isolateOCICredentials(t)
+	reg, archive := childChartRegistry(t)
+	// The registry serves a chart layer that does not match the digest in
+	// the OCI manifest.
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			if strings.HasSuffix(req.URL.Path, "/blobs/"+ociDigest(archive)) {
+				tampered := append([]byte{}, archive...)
+				tampered[len(tampered)-1] ^= 0xff
+				w.Header().Set("Content-Type", "application/octet-stream")
+				w.Write(tampered) // nolint:errcheck
+				return
+			}
+			reg.ServeHTTP(w, req)
+		},
+	))
+	t.Cleanup(srv.Close)
+	repoURL := "oci://" + strings.TrimPrefix(srv.URL, "http://") + "/charts/child"
+
+	_, err := kihelm.Inspect(
+		ctx, repoURL,
+		kihelm.WithChartVersion("1.0.1"),
+		kihelm.WithOCIOptions(kihelm.OCIWithPlainHTTP()),
+	)
+	require.NotNil(err)
+	require.ErrorContains(err, "digest")
+}
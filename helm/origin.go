@@ -0,0 +1,80 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	helmchart "helm.sh/helm/v3/pkg/chart"
+)
+
+// SubjectType describes the kind of subject that a Chart was inspected from.
+type SubjectType string
+
+const (
+	// SubjectTypeDirectory is an unpacked Helm Chart directory.
+	SubjectTypeDirectory SubjectType = "directory"
+	// SubjectTypeArchive is a local Helm Chart archive file.
+	SubjectTypeArchive SubjectType = "archive"
+	// SubjectTypeURL is a Helm Chart archive fetched from an HTTP(S) URL.
+	SubjectTypeURL SubjectType = "url"
+	// SubjectTypeHelmRepository is a Helm Chart archive resolved from a Helm
+	// repository's index file.
+	SubjectTypeHelmRepository SubjectType = "helm-repository"
+	// SubjectTypeOCI is a Helm Chart OCI artifact pulled from an OCI
+	// registry.
+	SubjectTypeOCI SubjectType = "oci"
+	// SubjectTypeGit is an unpacked Helm Chart directory checked out from a
+	// Git repository.
+	SubjectTypeGit SubjectType = "git"
+	// SubjectTypeChart is a helm sdk-go `*Chart` struct.
+	SubjectTypeChart SubjectType = "chart"
+	// SubjectTypeReader is a Helm Chart archive read from an `io.Reader`.
+	SubjectTypeReader SubjectType = "reader"
+)
+
+// Origin describes where an inspected Helm Chart came from.
+type Origin struct {
+	// SubjectType is the kind of subject that the Chart was inspected from.
+	SubjectType SubjectType
+	// Location is the ChartLocation of the Helm Chart, if known.
+	Location *ChartLocation
+	// URL is the filepath, HTTP(S) URL, OCI reference (including tag) or Git
+	// repository URL that the Helm Chart was loaded from, if any.
+	URL string
+	// Version is the resolved version of the Helm Chart.
+	Version string
+	// Digest is the SHA-256 digest of the Helm Chart archive, e.g.
+	// "sha256:1a2b...". Empty for unpacked Helm Chart directories and helm
+	// sdk-go `*Chart` structs.
+	Digest string
+	// OCIManifestDigest is the digest of the OCI manifest of the Helm Chart
+	// OCI artifact. Empty for Helm Charts not pulled from an OCI registry.
+	OCIManifestDigest string
+	// GitCommit is the Git commit that the Helm Chart was checked out from.
+	// Empty for Helm Charts not checked out from a Git repository.
+	GitCommit string
+}
+
+// Origin returns an Origin describing where the Helm Chart came from.
+func (c *Chart) Origin() *Origin {
+	return c.origin
+}
+
+// loadedChart is a loaded Helm Chart along with where it came from and the
+// result of verifying its provenance, if requested.
+type loadedChart struct {
+	chart        *helmchart.Chart
+	origin       *Origin
+	verification *Verification
+}
+
+// digestOf returns the SHA-256 digest of the supplied content, e.g.
+// "sha256:1a2b...".
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,99 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	kihelm "github.com/jaypipes/kube-inspect/helm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+func fileDigest(t *testing.T, path string) string {
+	b, err := os.ReadFile(path)
+	require.Nil(t, err)
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestOrigin(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+
+	c, err := kihelm.Inspect(ctx, umbrellaLocalChartDir)
+	require.Nil(err)
+	o := c.Origin()
+	require.NotNil(o)
+	assert.Equal(kihelm.SubjectTypeDirectory, o.SubjectType)
+	require.NotNil(o.Location)
+	assert.True(o.Location.IsLocal())
+	assert.Equal(umbrellaLocalChartDir, o.URL)
+	assert.Equal("0.1.0", o.Version)
+	assert.Empty(o.Digest)
+	assert.Empty(o.OCIManifestDigest)
+
+	archivePath := filepath.Join("testdata", "nginx-8.8.4.tgz")
+	expDigest := fileDigest(t, archivePath)
+	c, err = kihelm.Inspect(ctx, archivePath)
+	require.Nil(err)
+	o = c.Origin()
+	assert.Equal(kihelm.SubjectTypeArchive, o.SubjectType)
+	assert.Equal("8.8.4", o.Version)
+	assert.Equal(expDigest, o.Digest)
+
+	b, err := os.ReadFile(archivePath)
+	require.Nil(err)
+	c, err = kihelm.Inspect(ctx, bytes.NewReader(b))
+	require.Nil(err)
+	o = c.Origin()
+	assert.Equal(kihelm.SubjectTypeReader, o.SubjectType)
+	assert.Nil(o.Location)
+	assert.Equal(expDigest, o.Digest)
+
+	hc, err := loader.Load(archivePath)
+	require.Nil(err)
+	c, err = kihelm.Inspect(ctx, hc)
+	require.Nil(err)
+	o = c.Origin()
+	assert.Equal(kihelm.SubjectTypeChart, o.SubjectType)
+	assert.Equal("8.8.4", o.Version)
+	assert.Empty(o.Digest)
+}
+
+func TestOriginHelmRepository(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	srv := serveHelmRepository(t, "0.1.0", "0.2.0")
+
+	archiveURL := srv.URL + "/child-0.2.0.tgz"
+	c, err := kihelm.Inspect(ctx, archiveURL)
+	require.Nil(err)
+	o := c.Origin()
+	assert.Equal(kihelm.SubjectTypeURL, o.SubjectType)
+	assert.Equal(archiveURL, o.URL)
+	assert.Equal("0.2.0", o.Version)
+	assert.Contains(o.Digest, "sha256:")
+
+	loc, err := kihelm.ChartLocationFromURL(srv.URL + "/child")
+	require.Nil(err)
+	c, err = kihelm.InspectLocation(ctx, loc, "")
+	require.Nil(err)
+	locOrigin := c.Origin()
+	assert.Equal(kihelm.SubjectTypeHelmRepository, locOrigin.SubjectType)
+	assert.Equal(loc, locOrigin.Location)
+	assert.Equal(archiveURL, locOrigin.URL)
+	assert.Equal("0.2.0", locOrigin.Version)
+	assert.Equal(o.Digest, locOrigin.Digest)
+}
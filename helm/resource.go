@@ -7,10 +7,12 @@ package helm
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/samber/lo"
 	"github.com/santhosh-tekuri/jsonschema"
+	helmchartutil "helm.sh/helm/v3/pkg/chartutil"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
@@ -36,10 +38,17 @@ func (c *Chart) Resources(
 	// but not actually install anything). So we need to manually construct the
 	// set of Kubernetes resources by processing the rendered multi-document
 	// YAML manifest.
-	resources, err := kube.ResourcesFromManifest(ctx, c.manifest)
+	sourced, err := sourcedResourcesFromManifest(ctx, c.manifest.String())
 	if err != nil {
 		return nil, err
 	}
+	resources := make([]*unstructured.Unstructured, 0, len(sourced))
+	sources := make(map[string]string, len(sourced))
+	for _, sr := range sourced {
+		resources = append(resources, sr.resource)
+		sources[resourceKey(sr.resource)] = sr.source
+	}
+	c.sources = sources
 	for _, f := range filters {
 		resources = lo.Filter(resources, f)
 	}
@@ -56,11 +65,11 @@ type OptionalResource struct {
 	// DefaultName is the name of the Resource that would be rendered with the
 	// default values collection.
 	DefaultName string
-	// ValueToggle is the strvals notation for the configuration value that
-	// toggles the creation or enablement of this Resource. For example, assume
-	// the very common practice of optionally creating a ServiceAccount
-	// Resource when the `serviceAccount.create` value is set to "true", this
-	// field would contain "serviceAccount.create=true"
+	// ValueToggle is the dotted key of the configuration value that toggles
+	// the creation or enablement of this Resource. For example, assume the
+	// very common practice of optionally creating a ServiceAccount Resource
+	// when the `serviceAccount.create` value is set to "true", this field
+	// would contain "serviceAccount.create"
 	ValueToggle string
 	// DefaultEnabled is true when the Resource is created/enabled when the
 	// default values configuration is used during installation.
@@ -69,6 +78,14 @@ type OptionalResource struct {
 
 // OptionalResources returns a slice of OptionalResourceMeta objects that
 // describe the optional Kubernetes Resources that the Helm Chart may install.
+//
+// If the Helm Chart does not have a values JSONSchema, the JSONSchema
+// returned by InferValuesSchema() is used instead.
+//
+// Each boolean "resource enablement" configuration toggle found in the values
+// JSONSchema is resolved by rendering the Helm Chart with the toggle on and
+// off and comparing the rendered Resources. One OptionalResource is returned
+// for each Resource that is only rendered when the toggle is on.
 func (c *Chart) OptionalResources(
 	ctx context.Context,
 ) ([]*OptionalResource, error) {
@@ -78,18 +95,73 @@ func (c *Chart) OptionalResources(
 	}
 	ctx = debug.PushTrace(ctx, "helm:chart:optional-resources")
 	defer debug.PopTrace(ctx)
-	vs, err := c.loadValuesSchema(ctx)
+	vs, err := c.loadOrInferValuesSchema(ctx)
 	if err != nil {
 		return nil, err
 	}
-	res := []*OptionalResource{}
+	toggles := []string{}
 	if vs != nil {
 		// Look through the values schema property metadata for boolean
 		// "resource enablement" configuration toggles
 		for k, prop := range vs.Properties {
-			res = append(res, collectOptionalResources(
-				ctx, "", k, prop, nil)...,
+			toggles = append(toggles, collectResourceToggles(ctx, "", k, prop)...)
+		}
+	}
+	slices.Sort(toggles)
+	res := []*OptionalResource{}
+	if len(toggles) == 0 {
+		return res, nil
+	}
+	vals, err := helmchartutil.CoalesceValues(hc, c.inspectOpts.values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to coalesce values: %w", err)
+	}
+	baseline, err := c.Resources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, toggle := range toggles {
+		enabled := false
+		if v, err := vals.PathValue(toggle); err == nil {
+			enabled, _ = v.(bool)
+		}
+		flipped, err := c.resourcesWithSetValue(
+			ctx, fmt.Sprintf("%s=%t", toggle, !enabled),
+		)
+		if err != nil {
+			// Some toggles require other values to be set in order for the
+			// Helm Chart to render. We can't resolve those automatically.
+			debug.Printf(
+				ctx, "failed to render with %s=%t: %s\n", toggle, !enabled, err,
+			)
+			continue
+		}
+		off, on := baseline, flipped
+		if enabled {
+			off, on = flipped, baseline
+		}
+		rd, err := kube.DiffResources(off, on)
+		if err != nil {
+			return nil, err
+		}
+		added := rd.Added
+		slices.SortFunc(added, func(a, b *unstructured.Unstructured) int {
+			return strings.Compare(
+				a.GetKind()+"/"+a.GetName(), b.GetKind()+"/"+b.GetName(),
+			)
+		})
+		for _, r := range added {
+			or := &OptionalResource{
+				GroupKind:      r.GroupVersionKind().GroupKind(),
+				DefaultName:    r.GetName(),
+				ValueToggle:    toggle,
+				DefaultEnabled: enabled,
+			}
+			debug.Printf(
+				ctx, "%s toggles %s %s (enabled by default: %t)\n",
+				toggle, or.GroupKind, or.DefaultName, enabled,
 			)
+			res = append(res, or)
 		}
 	}
 	return res, nil
@@ -99,38 +171,30 @@ var (
 	resourceTogglePropNames = []string{"create", "enabled"}
 )
 
-// collectOptionalResources recursively searches through a `jsonschema.Schema`
-// object's properties looking for "enabled" or "created" property names and
-// returning the discovered OptionalResource structs.
-func collectOptionalResources(
+// collectResourceToggles recursively searches through a `jsonschema.Schema`
+// object's properties looking for boolean "enabled" or "create" property
+// names and returns the dotted keys of the discovered properties.
+func collectResourceToggles(
 	ctx context.Context,
 	dottedKey string,
 	propName string,
 	prop *jsonschema.Schema,
-	parent *jsonschema.Schema,
-) []*OptionalResource {
+) []string {
 	fullKey := propName
 	if dottedKey != "" {
 		fullKey = dottedKey + "." + propName
 	}
 	traceName := fmt.Sprintf(
-		"helm:chart:collect-optional-resource (%s)", fullKey,
+		"helm:chart:collect-resource-toggles (%s)", fullKey,
 	)
 	ctx = debug.PushTrace(ctx, traceName)
 	defer debug.PopTrace(ctx)
 	if likelyResourceToggle(propName, prop) {
-		return []*OptionalResource{
-			{
-				ValueToggle:    fullKey,
-				DefaultEnabled: true,
-			},
-		}
+		return []string{fullKey}
 	}
-	res := []*OptionalResource{}
+	res := []string{}
 	for k, p := range prop.Properties {
-		res = append(res, collectOptionalResources(
-			ctx, fullKey, k, p, prop)...,
-		)
+		res = append(res, collectResourceToggles(ctx, fullKey, k, p)...)
 	}
 	return res
 }
@@ -139,7 +203,7 @@ func likelyResourceToggle(
 	propName string,
 	prop *jsonschema.Schema,
 ) bool {
-	if len(prop.Types) > 1 || prop.Types[0] != "boolean" {
+	if len(prop.Types) != 1 || prop.Types[0] != "boolean" {
 		return false
 	}
 	return lo.Contains(resourceTogglePropNames, strings.ToLower(propName))
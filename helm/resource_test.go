@@ -10,6 +10,7 @@ import (
 
 	kihelm "github.com/jaypipes/kube-inspect/helm"
 	"github.com/jaypipes/kube-inspect/kube"
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -37,6 +38,17 @@ func TestOptionalResources(t *testing.T) {
 	// property is missing (but the "pdb.create" property is present in the
 	// schema)
 	assert.Contains(toggles, "pdb.create")
+
+	pdbs := lo.Filter(
+		optResources, func(r *kihelm.OptionalResource, _ int) bool {
+			return r.ValueToggle == "pdb.create"
+		},
+	)
+	require.Len(pdbs, 1)
+	assert.Equal("PodDisruptionBudget", pdbs[0].GroupKind.Kind)
+	assert.Equal("policy", pdbs[0].GroupKind.Group)
+	assert.Equal("kube-inspect-nginx", pdbs[0].DefaultName)
+	assert.False(pdbs[0].DefaultEnabled)
 }
 
 func TestFilterResourcesByName(t *testing.T) {
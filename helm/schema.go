@@ -5,11 +5,17 @@
 package helm
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
 	"strings"
 
 	"github.com/jaypipes/kube-inspect/debug"
 	"github.com/santhosh-tekuri/jsonschema"
+	helmchartutil "helm.sh/helm/v3/pkg/chartutil"
 )
 
 const (
@@ -34,14 +40,126 @@ func (c *Chart) loadValuesSchema(
 	}
 	ctx = debug.PushTrace(ctx, "helm:chart:load-jsonschema")
 	defer debug.PopTrace(ctx)
+	return compileValuesSchema(hc.Schema)
+}
+
+// loadOrInferValuesSchema returns the Helm Chart's values JSONSchema if the
+// Helm Chart has one, otherwise it returns a JSONSchema that was inferred from
+// the Helm Chart's values.yaml file and templates.
+func (c *Chart) loadOrInferValuesSchema(
+	ctx context.Context,
+) (*jsonschema.Schema, error) {
+	hc := c.Chart
+	if hc == nil {
+		return nil, nil
+	}
+	if hc.Schema != nil {
+		return c.loadValuesSchema(ctx)
+	}
+	schema, err := c.InferValuesSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return compileValuesSchema(schema)
+}
+
+// compileValuesSchema compiles the supplied JSONSchema document into a
+// `jsonschema.Schema` object.
+func compileValuesSchema(
+	schema []byte,
+) (*jsonschema.Schema, error) {
 	comp := jsonschema.NewCompiler()
 	comp.ExtractAnnotations = true
 	err := comp.AddResource(
 		latestJSONSchemaDraftURL,
-		strings.NewReader(string(hc.Schema)),
+		strings.NewReader(string(schema)),
 	)
 	if err != nil {
 		return nil, err
 	}
 	return comp.Compile(latestJSONSchemaDraftURL)
 }
+
+// ValuesViolation describes a way in which a collection of values does not
+// conform to the Helm Chart's values JSONSchema.
+type ValuesViolation struct {
+	// Path is the JSON pointer to the offending value, e.g. "/pdb/create".
+	Path string
+	// Keyword is the JSONSchema keyword that the value failed to satisfy,
+	// e.g. "type", "required" or "enum".
+	Keyword string
+	// Message describes the violation.
+	Message string
+}
+
+// String returns a simplified string representation of the ValuesViolation.
+func (v *ValuesViolation) String() string {
+	return fmt.Sprintf("%s: %s (%s)", v.Path, v.Message, v.Keyword)
+}
+
+// ValidateValues validates the supplied values overrides against the Helm
+// Chart's values JSONSchema and returns a slice of ValuesViolation structs
+// describing any values that do not conform to the JSONSchema. The overrides
+// are merged with the Helm Chart's default values before validation, just
+// like Helm does when installing the Helm Chart.
+//
+// If the Helm Chart does not have a values JSONSchema, an empty slice is
+// returned.
+func (c *Chart) ValidateValues(
+	ctx context.Context,
+	vals map[string]any,
+) ([]*ValuesViolation, error) {
+	ctx = debug.PushTrace(ctx, "helm:chart:validate-values")
+	defer debug.PopTrace(ctx)
+	vs, err := c.loadValuesSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := []*ValuesViolation{}
+	if vs == nil {
+		return res, nil
+	}
+	coalesced, err := helmchartutil.CoalesceValues(c.Chart, vals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to coalesce values: %w", err)
+	}
+	b, err := json.Marshal(coalesced)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal values: %w", err)
+	}
+	err = vs.Validate(bytes.NewReader(b))
+	if err == nil {
+		return res, nil
+	}
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return nil, err
+	}
+	res = collectValuesViolations(ve)
+	for _, v := range res {
+		debug.Printf(ctx, "found values violation: %s\n", v)
+	}
+	return res, nil
+}
+
+// collectValuesViolations recursively walks the supplied
+// `jsonschema.ValidationError` and returns a ValuesViolation for each of the
+// leaf errors, which are the errors that actually describe the violations.
+func collectValuesViolations(
+	ve *jsonschema.ValidationError,
+) []*ValuesViolation {
+	if len(ve.Causes) == 0 {
+		return []*ValuesViolation{
+			{
+				Path:    strings.TrimPrefix(ve.InstancePtr, "#"),
+				Keyword: path.Base(ve.SchemaPtr),
+				Message: ve.Message,
+			},
+		}
+	}
+	res := []*ValuesViolation{}
+	for _, cause := range ve.Causes {
+		res = append(res, collectValuesViolations(cause)...)
+	}
+	return res
+}
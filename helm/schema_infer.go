@@ -0,0 +1,223 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	helmchartutil "helm.sh/helm/v3/pkg/chartutil"
+
+	"github.com/jaypipes/kube-inspect/debug"
+)
+
+const (
+	inferredJSONSchemaDraftURL = "http://json-schema.org/draft-07/schema#"
+)
+
+var (
+	// paramAnnotationRegex matches the `## @param <key> <description>`
+	// annotations that Bitnami (and others) use to document values in their
+	// values.yaml files. The description may be preceded by a bracketed
+	// modifier such as `[string]` or `[default: REGISTRY_NAME]`.
+	paramAnnotationRegex = regexp.MustCompile(
+		`^\s*#+\s*@param\s+(\S+)\s*(?:\[[^\]]*\]\s*)?(.*)$`,
+	)
+	// templateValuesRefRegex matches references to values in templates, e.g.
+	// `.Values.serviceAccount.create`.
+	templateValuesRefRegex = regexp.MustCompile(
+		`\.Values((?:\.[A-Za-z_][A-Za-z0-9_]*)+)`,
+	)
+)
+
+// InferValuesSchema returns a JSONSchema document describing the Helm Chart's
+// values. This is useful for Helm Charts that do not have a values.schema.json
+// file.
+//
+// The JSONSchema is derived from:
+//
+//   - the types of the default values in the values.yaml file
+//   - `## @param <key> <description>` annotations and comments preceding
+//     keys in the values.yaml file, which are used as property descriptions
+//   - references to values (e.g. `.Values.podAnnotations`) in the Helm Chart's
+//     templates, which are added as untyped properties if they are not present
+//     in the values.yaml file
+func (c *Chart) InferValuesSchema(
+	ctx context.Context,
+) ([]byte, error) {
+	hc := c.Chart
+	if hc == nil {
+		return nil, fmt.Errorf("cannot infer values schema for nil chart.")
+	}
+	ctx = debug.PushTrace(ctx, "helm:chart:infer-values-schema")
+	defer debug.PopTrace(ctx)
+
+	var raw []byte
+	for _, f := range hc.Raw {
+		if f.Name == helmchartutil.ValuesfileName {
+			raw = f.Data
+			break
+		}
+	}
+	if raw == nil && hc.Values != nil {
+		// Charts that were not loaded from disk may not have the raw
+		// values.yaml file, in which case we infer the schema from the
+		// default values only.
+		b, err := yaml.Marshal(hc.Values)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal values: %w", err)
+		}
+		raw = b
+	}
+
+	schema := map[string]any{
+		"type":       "object",
+		"properties": map[string]any{},
+	}
+	if raw != nil {
+		var doc yaml.Node
+		if err := yaml.Unmarshal(raw, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse values.yaml: %w", err)
+		}
+		if len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+			params := paramDescriptions(raw)
+			schema = inferNodeSchema(doc.Content[0], "", params)
+		}
+	}
+
+	for _, t := range hc.Templates {
+		for _, m := range templateValuesRefRegex.FindAllStringSubmatch(string(t.Data), -1) {
+			keys := strings.Split(strings.TrimPrefix(m[1], "."), ".")
+			if addInferredProperty(schema, keys) {
+				debug.Printf(
+					ctx, "found value %q referenced in template %s\n",
+					strings.Join(keys, "."), t.Name,
+				)
+			}
+		}
+	}
+	schema["$schema"] = inferredJSONSchemaDraftURL
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// paramDescriptions returns a map, keyed by dotted value key, of the
+// descriptions found in `## @param <key> <description>` annotations in the
+// supplied values.yaml document.
+func paramDescriptions(raw []byte) map[string]string {
+	res := map[string]string{}
+	for _, line := range strings.Split(string(raw), "\n") {
+		m := paramAnnotationRegex.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		res[m[1]] = strings.TrimSpace(m[2])
+	}
+	return res
+}
+
+// inferNodeSchema returns a JSONSchema, represented as a map, describing the
+// supplied YAML node. The dottedKey argument is the key of the node within
+// the values collection and is used to look up descriptions in the supplied
+// `@param` annotation descriptions.
+func inferNodeSchema(
+	node *yaml.Node,
+	dottedKey string,
+	params map[string]string,
+) map[string]any {
+	schema := map[string]any{}
+	switch node.Kind {
+	case yaml.AliasNode:
+		return inferNodeSchema(node.Alias, dottedKey, params)
+	case yaml.MappingNode:
+		props := map[string]any{}
+		for x := 0; x+1 < len(node.Content); x += 2 {
+			keyNode, valNode := node.Content[x], node.Content[x+1]
+			key := keyNode.Value
+			fullKey := key
+			if dottedKey != "" {
+				fullKey = dottedKey + "." + key
+			}
+			prop := inferNodeSchema(valNode, fullKey, params)
+			if desc := params[fullKey]; desc != "" {
+				prop["description"] = desc
+			} else if desc := commentDescription(keyNode.HeadComment); desc != "" {
+				prop["description"] = desc
+			}
+			props[key] = prop
+		}
+		schema["type"] = "object"
+		schema["properties"] = props
+	case yaml.SequenceNode:
+		schema["type"] = "array"
+		if len(node.Content) > 0 {
+			schema["items"] = inferNodeSchema(node.Content[0], dottedKey+"[0]", params)
+		}
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!bool":
+			schema["type"] = "boolean"
+		case "!!int":
+			schema["type"] = "integer"
+		case "!!float":
+			schema["type"] = "number"
+		case "!!str":
+			schema["type"] = "string"
+		}
+		// null values are left untyped since we cannot tell what type of
+		// value is expected.
+	}
+	return schema
+}
+
+// commentDescription returns a description from the supplied YAML comment
+// block, stripped of comment markers, blank lines and annotations (e.g.
+// `@param` or `@section`).
+func commentDescription(comment string) string {
+	lines := []string{}
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#"))
+		if line == "" || strings.HasPrefix(line, "@") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, " ")
+}
+
+// addInferredProperty adds an untyped property for the supplied keys to the
+// supplied JSONSchema if the property does not already exist. Returns true if
+// a property was added.
+func addInferredProperty(
+	schema map[string]any,
+	keys []string,
+) bool {
+	added := false
+	for _, key := range keys {
+		if t, ok := schema["type"]; ok && t != "object" {
+			// The value is a scalar or array in values.yaml, so the template
+			// is likely using a method/field on the value that we don't know
+			// about.
+			return added
+		}
+		props, ok := schema["properties"].(map[string]any)
+		if !ok {
+			props = map[string]any{}
+			schema["type"] = "object"
+			schema["properties"] = props
+		}
+		next, ok := props[key].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			props[key] = next
+			added = true
+		}
+		schema = next
+	}
+	return added
+}
@@ -0,0 +1,156 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm_test
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	kihelm "github.com/jaypipes/kube-inspect/helm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	noSchemaLocalChartDir = filepath.Join("testdata", "noschema")
+)
+
+func TestValidateValues(t *testing.T) {
+	tcs := []struct {
+		name          string
+		vals          map[string]any
+		expViolations []kihelm.ValuesViolation
+	}{
+		{
+			"no overrides",
+			nil,
+			[]kihelm.ValuesViolation{},
+		},
+		{
+			"valid overrides",
+			map[string]any{
+				"replicaCount": 3,
+				"pdb": map[string]any{
+					"create": true,
+				},
+			},
+			[]kihelm.ValuesViolation{},
+		},
+		{
+			"invalid overrides",
+			map[string]any{
+				"replicaCount": "three",
+				"pdb": map[string]any{
+					"create": "yes",
+				},
+			},
+			[]kihelm.ValuesViolation{
+				{
+					Path:    "/pdb/create",
+					Keyword: "type",
+				},
+				{
+					Path:    "/replicaCount",
+					Keyword: "type",
+				},
+			},
+		},
+	}
+	ctx := context.TODO()
+	c, err := kihelm.Inspect(ctx, nginxLocalChartDir)
+	require.Nil(t, err)
+	for _, tc := range tcs {
+		t.Run(tc.name, func(tt *testing.T) {
+			require := require.New(tt)
+			assert := assert.New(tt)
+			got, err := c.ValidateValues(ctx, tc.vals)
+			require.Nil(err)
+			require.Len(got, len(tc.expViolations))
+			for _, exp := range tc.expViolations {
+				found := false
+				for _, v := range got {
+					if v.Path == exp.Path && v.Keyword == exp.Keyword {
+						assert.NotEmpty(v.Message)
+						found = true
+					}
+				}
+				assert.True(found, "expected violation %s (%s)", exp.Path, exp.Keyword)
+			}
+		})
+	}
+}
+
+func TestInferValuesSchema(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	c, err := kihelm.Inspect(ctx, noSchemaLocalChartDir)
+	require.Nil(err)
+
+	b, err := c.InferValuesSchema(ctx)
+	require.Nil(err)
+	schema := map[string]any{}
+	require.Nil(json.Unmarshal(b, &schema))
+
+	prop := func(keys ...string) map[string]any {
+		s := schema
+		for _, k := range keys {
+			props, ok := s["properties"].(map[string]any)
+			require.True(ok, "expected properties for %v", keys)
+			s, ok = props[k].(map[string]any)
+			require.True(ok, "expected property %s for %v", k, keys)
+		}
+		return s
+	}
+
+	assert.Equal("object", schema["type"])
+	assert.Equal("integer", prop("replicaCount")["type"])
+	assert.Equal("Number of replicas to deploy", prop("replicaCount")["description"])
+	assert.Equal("string", prop("image", "tag")["type"])
+	assert.Equal("Image tag", prop("image", "tag")["description"])
+	assert.Equal("boolean", prop("serviceAccount", "create")["type"])
+	assert.Equal(
+		"Specifies whether a ServiceAccount should be created",
+		prop("serviceAccount", "create")["description"],
+	)
+	// null default values are untyped
+	assert.NotContains(prop("serviceAccount", "name"), "type")
+	assert.Equal("integer", prop("metrics", "port")["type"])
+	// podAnnotations is not in values.yaml but is referenced in the
+	// deployment template
+	assert.NotNil(prop("podAnnotations"))
+}
+
+func TestOptionalResourcesInferredSchema(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	c, err := kihelm.Inspect(ctx, noSchemaLocalChartDir)
+	require.Nil(err)
+
+	optResources, err := c.OptionalResources(ctx)
+	require.Nil(err)
+	toggles := []string{}
+	for _, r := range optResources {
+		toggles = append(toggles, r.ValueToggle)
+	}
+	assert.Contains(toggles, "serviceAccount.create")
+	assert.Contains(toggles, "metrics.enabled")
+
+	for _, r := range optResources {
+		switch r.ValueToggle {
+		case "serviceAccount.create":
+			assert.Equal("ServiceAccount", r.GroupKind.Kind)
+			assert.Equal("kube-inspect", r.DefaultName)
+			assert.True(r.DefaultEnabled)
+		case "metrics.enabled":
+			assert.Equal("Service", r.GroupKind.Kind)
+			assert.Equal("kube-inspect-metrics", r.DefaultName)
+			assert.False(r.DefaultEnabled)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/jaypipes/kube-inspect/kube"
+)
+
+const (
+	// sourceCommentPrefix is the prefix of the comment that Helm places at the
+	// top of each document in a rendered manifest to indicate the template
+	// that rendered the document.
+	sourceCommentPrefix = "# Source: "
+)
+
+// SourceOf returns the path of the template that rendered the supplied
+// Kubernetes resource, e.g. "nginx/templates/deployment.yaml" or
+// "nginx/charts/common/templates/configmap.yaml" for a resource rendered by a
+// subchart. Returns an empty string if the resource was not rendered by the
+// Helm Chart.
+//
+// The supplied resource should be one returned by a call to
+// `Chart.Resources()`. Note that resources in a ChartDiff produced by
+// `Chart.Diff()` have the release name prefix stripped from their names.
+func (c *Chart) SourceOf(res *unstructured.Unstructured) string {
+	if res == nil || c.sources == nil {
+		return ""
+	}
+	return c.sources[resourceKey(res)]
+}
+
+// resourceKey returns a string that uniquely identifies the supplied
+// Kubernetes resource within a rendered manifest.
+func resourceKey(res *unstructured.Unstructured) string {
+	return fmt.Sprintf(
+		"%s/%s/%s",
+		res.GroupVersionKind().String(), res.GetNamespace(), res.GetName(),
+	)
+}
+
+// sourcedResource is a Kubernetes resource along with the path of the
+// template that rendered it.
+type sourcedResource struct {
+	resource *unstructured.Unstructured
+	// source is the path of the template that rendered the resource, e.g.
+	// "nginx/templates/svc.yaml".
+	source string
+}
+
+// sourcedResourcesFromManifest processes the supplied rendered manifest and
+// returns the Kubernetes resources found in it along with the path of the
+// template that rendered each resource.
+func sourcedResourcesFromManifest(
+	ctx context.Context,
+	manifest string,
+) ([]*sourcedResource, error) {
+	res := []*sourcedResource{}
+	source := ""
+	for _, doc := range splitManifest(manifest) {
+		for _, line := range strings.Split(doc, "\n") {
+			if after, ok := strings.CutPrefix(line, sourceCommentPrefix); ok {
+				source = strings.TrimSpace(after)
+				break
+			}
+		}
+		// Documents without a source comment (e.g. the second document in a
+		// multi-document file in the crds/ directory) belong to the same
+		// template as the previous document.
+		resources, err := kube.ResourcesFromManifest(
+			ctx, bytes.NewBufferString(doc),
+		)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range resources {
+			res = append(res, &sourcedResource{resource: r, source: source})
+		}
+	}
+	return res, nil
+}
+
+// splitManifest splits the supplied multi-document YAML manifest into its
+// individual documents, in order. Only a `---` document separator at the start
+// of a line splits the manifest, so a `---` line within an indented block
+// scalar (e.g. in a ConfigMap's data) does not.
+func splitManifest(manifest string) []string {
+	docs := releaseutil.SplitManifests(manifest)
+	keys := lo.Keys(docs)
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+	return lo.Map(keys, func(key string, _ int) string {
+		return docs[key]
+	})
+}
@@ -0,0 +1,153 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm_test
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+
+	kihelm "github.com/jaypipes/kube-inspect/helm"
+	"github.com/jaypipes/kube-inspect/kube"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSourceOf(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	c, err := kihelm.Inspect(ctx, nginxLocalChartDir)
+	require.Nil(err)
+
+	resources, err := c.Resources(ctx)
+	require.Nil(err)
+	sources := map[string]string{}
+	for _, r := range resources {
+		sources[r.GetKind()] = c.SourceOf(r)
+	}
+	assert.Equal("nginx/templates/deployment.yaml", sources["Deployment"])
+	assert.Equal("nginx/templates/svc.yaml", sources["Service"])
+	assert.Equal(
+		"nginx/templates/server-block-configmap.yaml", sources["ConfigMap"],
+	)
+
+	unknown := &unstructured.Unstructured{}
+	unknown.SetKind("Secret")
+	unknown.SetName("unknown")
+	assert.Equal("", c.SourceOf(unknown))
+}
+
+func TestSourceOfBlockScalarSeparator(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	hc := &helmchart.Chart{
+		Metadata: &helmchart.Metadata{
+			APIVersion: helmchart.APIVersionV2,
+			Name:       "separator",
+			Version:    "0.1.0",
+		},
+		Templates: []*helmchart.File{
+			{
+				Name: "templates/configmap.yaml",
+				Data: []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: front-matter
+data:
+  post.md: |
+    ---
+    title: hello
+    ---
+    body
+`),
+			},
+			{
+				Name: "templates/secret.yaml",
+				Data: []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: creds
+stringData:
+  password: hunter2
+`),
+			},
+		},
+	}
+	c, err := kihelm.Inspect(ctx, hc)
+	require.Nil(err)
+
+	resources, err := c.Resources(ctx)
+	require.Nil(err)
+	require.Len(resources, 2)
+	sources := map[string]string{}
+	for _, r := range resources {
+		sources[r.GetKind()] = c.SourceOf(r)
+		if r.GetKind() == "ConfigMap" {
+			post, _, err := unstructured.NestedString(
+				r.Object, "data", "post.md",
+			)
+			require.Nil(err)
+			assert.Equal("---\ntitle: hello\n---\nbody\n", post)
+		}
+	}
+	assert.Equal("separator/templates/configmap.yaml", sources["ConfigMap"])
+	assert.Equal("separator/templates/secret.yaml", sources["Secret"])
+}
+
+func TestSourceOfSubchart(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	c, err := kihelm.Inspect(ctx, umbrellaLocalChartDir)
+	require.Nil(err)
+
+	resources, err := c.Resources(ctx, kube.WithName("kube-inspect-child"))
+	require.Nil(err)
+	require.Len(resources, 1)
+	assert.Equal(
+		"umbrella/charts/child/templates/configmap.yaml",
+		c.SourceOf(resources[0]),
+	)
+}
+
+func TestSourceOfDiff(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+
+	af, err := os.Open(certManager1_17_1_LocalChartPath)
+	require.Nil(err)
+	ac, err := kihelm.Inspect(ctx, af)
+	require.Nil(err)
+
+	bf, err := os.Open(certManager1_18_0_LocalChartPath)
+	require.Nil(err)
+	bc, err := kihelm.Inspect(ctx, bf)
+	require.Nil(err)
+
+	diff, err := ac.Diff(ctx, bc)
+	require.Nil(err)
+	require.NotEmpty(diff.Resources.Added)
+
+	// Diffing doesn't rename the Chart's resources, so the resources added
+	// can be looked up by their original names, which usually have the
+	// release name prefix.
+	brs, err := bc.Resources(ctx)
+	require.Nil(err)
+	for _, added := range diff.Resources.Added {
+		prefixed := kihelm.DefaultReleaseName + "-" + added.GetName()
+		idx := slices.IndexFunc(brs, func(r *unstructured.Unstructured) bool {
+			return r.GetKind() == added.GetKind() &&
+				(r.GetName() == prefixed || r.GetName() == added.GetName())
+		})
+		require.NotEqual(-1, idx, "resource %s not found", added.GetName())
+		assert.Equal("cert-manager/templates/rbac.yaml", bc.SourceOf(brs[idx]))
+	}
+}
@@ -0,0 +1,300 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/santhosh-tekuri/jsonschema"
+	helmchartutil "helm.sh/helm/v3/pkg/chartutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/jaypipes/kube-inspect/debug"
+	"github.com/jaypipes/kube-inspect/kube"
+)
+
+// ValueImpact describes the Kubernetes Resources, and the fields within those
+// Resources, that are affected by a change to a configuration value.
+type ValueImpact struct {
+	// Key is the dotted key of the configuration value, e.g.
+	// "image.tag".
+	Key string
+	// Fields is a map, keyed by full resource name
+	// (APIGroupVersion/Kind/ResourceName), of the paths of the fields within
+	// the resource that change when the configuration value changes, e.g.
+	// "/spec/replicas".
+	Fields map[string][]string
+	// Added contains resources that are rendered only when the
+	// configuration value changes.
+	Added []*unstructured.Unstructured
+	// Removed contains resources that are no longer rendered when the
+	// configuration value changes.
+	Removed []*unstructured.Unstructured
+}
+
+// IsEmpty returns true if the configuration value does not affect any
+// Kubernetes Resources.
+func (i *ValueImpact) IsEmpty() bool {
+	return len(i.Fields) == 0 && len(i.Added) == 0 && len(i.Removed) == 0
+}
+
+// valueCandidate is a configuration value whose impact can be determined.
+type valueCandidate struct {
+	// value is the current value, which may be nil.
+	value any
+	// schemaType is the JSONSchema type of the value, if known.
+	schemaType string
+}
+
+// changed returns a value that is different from the candidate's current
+// value and of the same type. Returns false if no such value can be
+// determined, e.g. for lists and maps or for null values with an unknown
+// type.
+func (v *valueCandidate) changed() (any, bool) {
+	switch val := v.value.(type) {
+	case bool:
+		return !val, true
+	case int:
+		return val + 1, true
+	case int64:
+		return val + 1, true
+	case float64:
+		return val + 1, true
+	case string:
+		if val == "" {
+			return "kube-inspect", true
+		}
+		return val + "-kube-inspect", true
+	case nil:
+		switch v.schemaType {
+		case "boolean":
+			return true, true
+		case "integer", "number":
+			return 1, true
+		case "string":
+			return "kube-inspect", true
+		}
+	}
+	return nil, false
+}
+
+// ValueImpact returns a ValueImpact describing the Kubernetes Resources and
+// fields that are affected by the configuration value with the supplied
+// dotted key, e.g. "replicaCount" or "image.tag".
+//
+// The impact is determined by rendering the Helm Chart with a changed value
+// (e.g. a flipped boolean or an incremented number) and comparing the
+// rendered Resources with those rendered using the original value. The
+// original value comes from the values used to inspect the Helm Chart (merged
+// with the Helm Chart's default values) or, when there is no default value,
+// from the type of the value in the values JSONSchema.
+func (c *Chart) ValueImpact(
+	ctx context.Context,
+	key string,
+) (*ValueImpact, error) {
+	if c.Chart == nil {
+		return nil, fmt.Errorf("cannot determine value impact for nil chart.")
+	}
+	ctx = debug.PushTrace(ctx, "helm:chart:value-impact")
+	defer debug.PopTrace(ctx)
+	candidates, err := c.valueCandidates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	candidate, ok := candidates[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown value %q", key)
+	}
+	baseline, err := c.Resources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.valueImpact(ctx, key, candidate, baseline)
+}
+
+// ValueImpactMap returns a map, keyed by the dotted key of each configuration
+// value, of ValueImpact structs describing the Kubernetes Resources and fields
+// that are affected by that configuration value. Configuration values that do
+// not affect any Kubernetes Resources are not included.
+//
+// See ValueImpact() for details on how the impact of each configuration value
+// is determined. Note that this renders the Helm Chart once for each
+// configuration value.
+func (c *Chart) ValueImpactMap(
+	ctx context.Context,
+) (map[string]*ValueImpact, error) {
+	if c.Chart == nil {
+		return nil, fmt.Errorf("cannot determine value impact for nil chart.")
+	}
+	ctx = debug.PushTrace(ctx, "helm:chart:value-impact-map")
+	defer debug.PopTrace(ctx)
+	candidates, err := c.valueCandidates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	baseline, err := c.Resources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys := lo.Keys(candidates)
+	slices.Sort(keys)
+	res := map[string]*ValueImpact{}
+	for _, key := range keys {
+		impact, err := c.valueImpact(ctx, key, candidates[key], baseline)
+		if err != nil {
+			// Plenty of values cannot be changed arbitrarily (e.g. a string
+			// that must be one of a set of enumerated values), so we just
+			// skip them.
+			debug.Printf(ctx, "skipping value %q: %s\n", key, err)
+			continue
+		}
+		if impact.IsEmpty() {
+			continue
+		}
+		res[key] = impact
+	}
+	return res, nil
+}
+
+// valueImpact renders the Helm Chart with a changed value for the supplied
+// candidate and returns the differences between the rendered Resources and
+// the supplied baseline Resources.
+func (c *Chart) valueImpact(
+	ctx context.Context,
+	key string,
+	candidate *valueCandidate,
+	baseline []*unstructured.Unstructured,
+) (*ValueImpact, error) {
+	changed, ok := candidate.changed()
+	if !ok {
+		return nil, fmt.Errorf(
+			"unable to determine a changed value for %q", key,
+		)
+	}
+	vals := copyValues(c.inspectOpts.values)
+	setValuePath(vals, strings.Split(key, "."), changed)
+	resources, err := c.resourcesWithValues(ctx, vals)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to render with changed value for %q: %w", key, err,
+		)
+	}
+	rd, err := kube.DiffResources(baseline, resources)
+	if err != nil {
+		return nil, err
+	}
+	impact := &ValueImpact{
+		Key:     key,
+		Fields:  map[string][]string{},
+		Added:   rd.Added,
+		Removed: rd.Removed,
+	}
+	for name, d := range rd.Changed {
+		impact.Fields[name] = d.Paths()
+	}
+	return impact, nil
+}
+
+// valueCandidates returns a map, keyed by dotted key, of the configuration
+// values whose impact can be determined. These are the scalar values in the
+// values used to inspect the Helm Chart (merged with the Helm Chart's default
+// values) along with any scalar properties in the values JSONSchema.
+func (c *Chart) valueCandidates(
+	ctx context.Context,
+) (map[string]*valueCandidate, error) {
+	vals, err := helmchartutil.CoalesceValues(c.Chart, c.inspectOpts.values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to coalesce values: %w", err)
+	}
+	res := map[string]*valueCandidate{}
+	collectValueCandidates("", vals, res)
+	vs, err := c.loadOrInferValuesSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if vs != nil {
+		collectSchemaValueCandidates("", vs, res)
+	}
+	return res, nil
+}
+
+// collectValueCandidates recursively collects the scalar values in the
+// supplied values collection into the supplied map of value candidates.
+func collectValueCandidates(
+	dottedKey string,
+	vals map[string]any,
+	res map[string]*valueCandidate,
+) {
+	for k, v := range vals {
+		fullKey := k
+		if dottedKey != "" {
+			fullKey = dottedKey + "." + k
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			collectValueCandidates(fullKey, v, res)
+		case helmchartutil.Values:
+			collectValueCandidates(fullKey, v, res)
+		case []any:
+			continue
+		default:
+			res[fullKey] = &valueCandidate{value: v}
+		}
+	}
+}
+
+// collectSchemaValueCandidates recursively collects the scalar properties in
+// the supplied JSONSchema into the supplied map of value candidates.
+func collectSchemaValueCandidates(
+	dottedKey string,
+	schema *jsonschema.Schema,
+	res map[string]*valueCandidate,
+) {
+	for k, prop := range schema.Properties {
+		fullKey := k
+		if dottedKey != "" {
+			fullKey = dottedKey + "." + k
+		}
+		if len(prop.Properties) > 0 {
+			collectSchemaValueCandidates(fullKey, prop, res)
+			continue
+		}
+		if len(prop.Types) != 1 {
+			continue
+		}
+		switch prop.Types[0] {
+		case "object", "array", "null":
+			continue
+		}
+		if candidate, ok := res[fullKey]; ok {
+			candidate.schemaType = prop.Types[0]
+		} else {
+			res[fullKey] = &valueCandidate{schemaType: prop.Types[0]}
+		}
+	}
+}
+
+// setValuePath sets the value at the supplied path of keys in the supplied
+// values collection, creating any intermediate maps as necessary.
+func setValuePath(
+	vals map[string]any,
+	keys []string,
+	value any,
+) {
+	m := vals
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := m[k].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			m[k] = next
+		}
+		m = next
+	}
+	m[keys[len(keys)-1]] = value
+}
@@ -0,0 +1,81 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	kihelm "github.com/jaypipes/kube-inspect/helm"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestValueImpact(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	c, err := kihelm.Inspect(ctx, nginxLocalChartDir)
+	require.Nil(err)
+
+	impact, err := c.ValueImpact(ctx, "replicaCount")
+	require.Nil(err)
+	assert.Equal("replicaCount", impact.Key)
+	assert.Empty(impact.Added)
+	assert.Empty(impact.Removed)
+	require.Contains(impact.Fields, "apps/v1/Deployment/kube-inspect-nginx")
+	assert.Equal(
+		[]string{"/spec/replicas"},
+		impact.Fields["apps/v1/Deployment/kube-inspect-nginx"],
+	)
+
+	impact, err = c.ValueImpact(ctx, "serviceAccount.create")
+	require.Nil(err)
+	added := lo.Map(
+		impact.Added, func(r *unstructured.Unstructured, _ int) string {
+			return r.GetKind()
+		},
+	)
+	assert.Contains(added, "ServiceAccount")
+
+	_, err = c.ValueImpact(ctx, "does.not.exist")
+	assert.ErrorContains(err, `unknown value "does.not.exist"`)
+}
+
+func TestValueImpactMap(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	c, err := kihelm.Inspect(ctx, noSchemaLocalChartDir)
+	require.Nil(err)
+
+	impacts, err := c.ValueImpactMap(ctx)
+	require.Nil(err)
+
+	require.Contains(impacts, "image.tag")
+	fields := impacts["image.tag"].Fields["apps/v1/Deployment/kube-inspect"]
+	require.Len(fields, 1)
+	assert.True(strings.HasSuffix(fields[0], "/image"), fields[0])
+
+	require.Contains(impacts, "metrics.enabled")
+	require.Len(impacts["metrics.enabled"].Added, 1)
+	assert.Equal("Service", impacts["metrics.enabled"].Added[0].GetKind())
+	assert.Empty(impacts["metrics.enabled"].Removed)
+
+	// serviceAccount.create defaults to true, so changing it removes the
+	// only ServiceAccount.
+	require.Contains(impacts, "serviceAccount.create")
+	removed := impacts["serviceAccount.create"].Removed
+	require.Len(removed, 1)
+	assert.Equal("ServiceAccount", removed[0].GetKind())
+	assert.Empty(impacts["serviceAccount.create"].Added)
+
+	// metrics.port only affects the metrics Service, which is not rendered
+	// by default.
+	assert.NotContains(impacts, "metrics.port")
+}
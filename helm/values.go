@@ -0,0 +1,189 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	helmchartutil "helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/strvals"
+)
+
+// valuesLayer returns a collection of values that is merged, in order, with
+// other values layers. Values layers correspond to the `-f/--values` flag of
+// the helm CLI.
+type valuesLayer func() (map[string]any, error)
+
+// WithValuesFiles adds one or more values.yaml files to the values that are
+// used when rendering the Helm Chart. This is the equivalent of passing
+// `-f/--values` to the helm CLI. Files are merged in the order supplied and
+// are overridden by any of the "set" values options (e.g. WithSetString()).
+func WithValuesFiles(paths ...string) InspectOption {
+	return func(opts *InspectOptions) {
+		for _, path := range paths {
+			opts.valuesLayers = append(
+				opts.valuesLayers,
+				func() (map[string]any, error) {
+					vals, err := helmchartutil.ReadValuesFile(path)
+					if err != nil {
+						return nil, fmt.Errorf(
+							"failed to read values file %q: %w", path, err,
+						)
+					}
+					return vals, nil
+				},
+			)
+		}
+	}
+}
+
+// WithValuesReader adds a values.yaml document read from the supplied
+// io.Reader to the values that are used when rendering the Helm Chart. The
+// document is merged with any other values files in the order supplied.
+func WithValuesReader(r io.Reader) InspectOption {
+	return func(opts *InspectOptions) {
+		opts.valuesLayers = append(
+			opts.valuesLayers,
+			func() (map[string]any, error) {
+				b, err := io.ReadAll(r)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read values: %w", err)
+				}
+				vals, err := helmchartutil.ReadValues(b)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse values: %w", err)
+				}
+				return vals, nil
+			},
+		)
+	}
+}
+
+// WithSetString adds a "strvals" string, e.g. "image.tag=1.2.3", to the
+// values used when rendering the Helm Chart. All values are interpreted as
+// strings. This is the equivalent of passing `--set-string` to the helm CLI.
+func WithSetString(vals string) InspectOption {
+	return func(opts *InspectOptions) {
+		opts.stringValues = append(opts.stringValues, vals)
+	}
+}
+
+// WithSetFile adds a "strvals" string, e.g. "config=path/to/config.toml", to
+// the values used when rendering the Helm Chart. The value for each key is the
+// content of the file at the supplied path. This is the equivalent of passing
+// `--set-file` to the helm CLI.
+func WithSetFile(vals string) InspectOption {
+	return func(opts *InspectOptions) {
+		opts.fileValues = append(opts.fileValues, vals)
+	}
+}
+
+// WithSetJSON adds a JSON "strvals" string, e.g. `resources={"cpu": "1"}`, to
+// the values used when rendering the Helm Chart. This is the equivalent of
+// passing `--set-json` to the helm CLI.
+func WithSetJSON(vals string) InspectOption {
+	return func(opts *InspectOptions) {
+		opts.jsonValues = append(opts.jsonValues, vals)
+	}
+}
+
+// mergeValues returns the values that result from merging all the values
+// sources in the InspectOptions. The precedence order is the same as the helm
+// CLI: values files (and readers and maps) in the order supplied, followed by
+// `--set-json`, `--set`, `--set-string` and `--set-file` values.
+//
+// Returns nil if no values sources were supplied.
+func (o *InspectOptions) mergeValues() (map[string]any, error) {
+	if len(o.valuesLayers) == 0 &&
+		len(o.jsonValues) == 0 &&
+		len(o.setValues) == 0 &&
+		len(o.stringValues) == 0 &&
+		len(o.fileValues) == 0 {
+		return nil, nil
+	}
+	base := map[string]any{}
+	for _, layer := range o.valuesLayers {
+		vals, err := layer()
+		if err != nil {
+			return nil, err
+		}
+		// Layers are copied so that `--set` style values below do not modify
+		// maps owned by the caller.
+		base = mergeMaps(base, copyValues(vals))
+	}
+	for _, s := range o.jsonValues {
+		if err := strvals.ParseJSON(s, base); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON values %q: %w", s, err)
+		}
+	}
+	for _, s := range o.setValues {
+		if err := strvals.ParseInto(s, base); err != nil {
+			return nil, fmt.Errorf("failed to parse values %q: %w", s, err)
+		}
+	}
+	for _, s := range o.stringValues {
+		if err := strvals.ParseIntoString(s, base); err != nil {
+			return nil, fmt.Errorf("failed to parse string values %q: %w", s, err)
+		}
+	}
+	for _, s := range o.fileValues {
+		reader := func(rs []rune) (any, error) {
+			b, err := os.ReadFile(string(rs))
+			return string(b), err
+		}
+		if err := strvals.ParseIntoFile(s, base, reader); err != nil {
+			return nil, fmt.Errorf("failed to parse file values %q: %w", s, err)
+		}
+	}
+	return base, nil
+}
+
+// mergeMaps recursively merges map b into map a, with values in b taking
+// precedence. This is the same merge that the helm CLI performs for values
+// files.
+func mergeMaps(a, b map[string]any) map[string]any {
+	out := make(map[string]any, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		if v, ok := v.(map[string]any); ok {
+			if bv, ok := out[k]; ok {
+				if bv, ok := bv.(map[string]any); ok {
+					out[k] = mergeMaps(bv, v)
+					continue
+				}
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// copyValues returns a deep copy of the supplied values collection so that it
+// may be modified without affecting the original.
+func copyValues(vals map[string]any) map[string]any {
+	out := make(map[string]any, len(vals))
+	for k, v := range vals {
+		out[k] = copyValue(v)
+	}
+	return out
+}
+
+func copyValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		return copyValues(v)
+	case []any:
+		out := make([]any, len(v))
+		for x, item := range v {
+			out[x] = copyValue(item)
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,170 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	kihelm "github.com/jaypipes/kube-inspect/helm"
+	"github.com/jaypipes/kube-inspect/kube"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var (
+	pdbAndServiceAccountValuesPath = filepath.Join("testdata", "values", "pdb-and-serviceaccount.yaml")
+	serverBlockPath                = filepath.Join("testdata", "values", "server-block.conf")
+)
+
+func TestInspectWithValuesFiles(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	c, err := kihelm.Inspect(
+		ctx, nginxLocalChartDir,
+		kihelm.WithValuesFiles(pdbAndServiceAccountValuesPath),
+	)
+	require.Nil(err)
+
+	resources, err := c.Resources(ctx)
+	require.Nil(err)
+	resourceKinds := []string{}
+	for _, r := range resources {
+		resourceKinds = append(resourceKinds, r.GetKind())
+	}
+	assert.Len(resources, 5)
+	assert.Contains(resourceKinds, "ServiceAccount")
+	assert.Contains(resourceKinds, "PodDisruptionBudget")
+}
+
+func TestInspectValuesPrecedence(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	// --set values override values files regardless of the order in which
+	// the options are supplied, and later values files override earlier
+	// ones.
+	c, err := kihelm.Inspect(
+		ctx, nginxLocalChartDir,
+		kihelm.WithValues("pdb.create=false"),
+		kihelm.WithValuesFiles(pdbAndServiceAccountValuesPath),
+		kihelm.WithValuesReader(
+			strings.NewReader("serviceAccount:\n  create: false\n"),
+		),
+		kihelm.WithSetJSON(`replicaCount=2`),
+		kihelm.WithSetString("replicaCount=3"),
+	)
+	require.Nil(err)
+
+	resources, err := c.Resources(ctx)
+	require.Nil(err)
+	resourceKinds := []string{}
+	for _, r := range resources {
+		resourceKinds = append(resourceKinds, r.GetKind())
+	}
+	assert.Len(resources, 3)
+	assert.NotContains(resourceKinds, "ServiceAccount")
+	assert.NotContains(resourceKinds, "PodDisruptionBudget")
+
+	deployments, err := c.Resources(ctx, kube.WithKind("Deployment"))
+	require.Nil(err)
+	require.Len(deployments, 1)
+	replicas, _, err := unstructured.NestedInt64(
+		deployments[0].Object, "spec", "replicas",
+	)
+	require.Nil(err)
+	assert.Equal(int64(3), replicas)
+}
+
+func TestInspectReusedValuesMap(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	vals := map[string]any{
+		"pdb": map[string]any{"create": true},
+	}
+	// --set values must not modify the caller's values map.
+	c, err := kihelm.Inspect(
+		ctx, nginxLocalChartDir,
+		kihelm.WithValues(vals),
+		kihelm.WithValues("pdb.create=false"),
+	)
+	require.Nil(err)
+	pdbs, err := c.Resources(ctx, kube.WithKind("PodDisruptionBudget"))
+	require.Nil(err)
+	assert.Empty(pdbs)
+	assert.Equal(map[string]any{"create": true}, vals["pdb"])
+
+	c, err = kihelm.Inspect(ctx, nginxLocalChartDir, kihelm.WithValues(vals))
+	require.Nil(err)
+	pdbs, err = c.Resources(ctx, kube.WithKind("PodDisruptionBudget"))
+	require.Nil(err)
+	assert.Len(pdbs, 1)
+}
+
+func TestInspectWithSetFile(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	c, err := kihelm.Inspect(
+		ctx, nginxLocalChartDir,
+		kihelm.WithSetFile("serverBlock="+serverBlockPath),
+	)
+	require.Nil(err)
+
+	cms, err := c.Resources(ctx, kube.WithName("kube-inspect-nginx-server-block"))
+	require.Nil(err)
+	require.Len(cms, 1)
+	block, _, err := unstructured.NestedString(
+		cms[0].Object, "data", "server-block.conf",
+	)
+	require.Nil(err)
+	assert.Contains(block, "listen 0.0.0.0:8080;")
+}
+
+func TestInspectValuesErrors(t *testing.T) {
+	tcs := []struct {
+		name   string
+		opt    kihelm.InspectOption
+		expErr string
+	}{
+		{
+			"invalid strvals",
+			kihelm.WithValues("pdb.create"),
+			"failed to parse values",
+		},
+		{
+			"invalid JSON",
+			kihelm.WithSetJSON("pdb={"),
+			"failed to parse JSON values",
+		},
+		{
+			"missing values file",
+			kihelm.WithValuesFiles(filepath.Join("testdata", "values", "missing.yaml")),
+			"failed to read values file",
+		},
+		{
+			"invalid values document",
+			kihelm.WithValuesReader(strings.NewReader("pdb: [")),
+			"failed to parse values",
+		},
+		{
+			"unhandled values type",
+			kihelm.WithValues(42),
+			"unhandled type for values: int",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(tt *testing.T) {
+			assert := assert.New(tt)
+			_, err := kihelm.Inspect(context.TODO(), nginxLocalChartDir, tc.opt)
+			assert.ErrorContains(err, tc.expErr)
+		})
+	}
+}
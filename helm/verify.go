@@ -0,0 +1,117 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/provenance"
+
+	"github.com/jaypipes/kube-inspect/debug"
+)
+
+// Verification describes the result of verifying the provenance of a Helm
+// Chart against a keyring.
+type Verification struct {
+	// SignedBy contains the identities (e.g. "Jane Doe <jane@example.com>")
+	// of the key that signed the Helm Chart.
+	SignedBy []string
+	// KeyFingerprint is the hex-encoded fingerprint of the key that signed
+	// the Helm Chart.
+	KeyFingerprint string
+	// FileName is the name of the signed Helm Chart archive, e.g.
+	// "nginx-8.8.4.tgz".
+	FileName string
+	// FileHash is the digest of the Helm Chart archive recorded in the
+	// provenance file, e.g. "sha256:1a2b...".
+	FileHash string
+	// Digest is the digest of the Helm Chart archive layer of the OCI
+	// artifact, which has been verified against the archive's content. Empty
+	// for Helm Charts not pulled from an OCI registry.
+	Digest string
+}
+
+// WithKeyring instructs Inspect to verify the provenance of the Helm Chart
+// against the PGP public keyring at the supplied path, in the same way as
+// passing `--verify --keyring` to the helm CLI. Inspect fails if the Helm
+// Chart cannot be verified.
+//
+// For Helm Chart archives that are local files or fetched from an HTTP(S) URL,
+// the provenance file is expected alongside the archive, with a ".prov"
+// suffix. For Helm Charts pulled from an OCI registry, the provenance file is
+// pulled from the OCI artifact and the digest of the archive layer is also
+// verified. Unpacked Helm Chart directories, `io.Reader`s and helm sdk-go
+// `*Chart` structs cannot be verified.
+//
+// The result of verification is available from Chart.Verification().
+func WithKeyring(path string) InspectOption {
+	return func(opts *InspectOptions) {
+		opts.keyring = path
+	}
+}
+
+// Verification returns the result of verifying the provenance of the Helm
+// Chart, or nil if WithKeyring() was not supplied to Inspect().
+func (c *Chart) Verification() *Verification {
+	return c.verification
+}
+
+// verifyArchiveData verifies the supplied Helm Chart archive content using
+// the supplied provenance file content and keyring. The fileName argument is
+// the name of the archive as recorded in the provenance file.
+func verifyArchiveData(
+	ctx context.Context,
+	data []byte,
+	fileName string,
+	prov []byte,
+	keyring string,
+) (*Verification, error) {
+	ctx = debug.PushTrace(ctx, "helm:verify-archive")
+	defer debug.PopTrace(ctx)
+	sig, err := provenance.NewFromKeyring(keyring, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keyring %q: %w", keyring, err)
+	}
+	// The provenance package only verifies files on disk, and looks up the
+	// archive's digest in the provenance file by the archive's file name.
+	tmpDir, err := os.MkdirTemp("", "kube-inspect-verify")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	archivePath := filepath.Join(tmpDir, fileName)
+	if err := os.WriteFile(archivePath, data, 0o600); err != nil {
+		return nil, err
+	}
+	provPath := archivePath + ".prov"
+	if err := os.WriteFile(provPath, prov, 0o600); err != nil {
+		return nil, err
+	}
+	pv, err := sig.Verify(archivePath, provPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify %s: %w", fileName, err)
+	}
+	v := &Verification{
+		FileName: pv.FileName,
+		FileHash: pv.FileHash,
+	}
+	if pv.SignedBy != nil {
+		for name := range pv.SignedBy.Identities {
+			v.SignedBy = append(v.SignedBy, name)
+		}
+		slices.Sort(v.SignedBy)
+		v.KeyFingerprint = strings.ToUpper(
+			hex.EncodeToString(pv.SignedBy.PrimaryKey.Fingerprint[:]),
+		)
+	}
+	debug.Printf(ctx, "verified %s signed by %v\n", fileName, v.SignedBy)
+	return v, nil
+}
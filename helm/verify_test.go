@@ -0,0 +1,145 @@
+// Use and distribution licensed under the Apache license version 2.
+//
+// See the COPYING file in the root project directory for full text.
+
+package helm_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	kihelm "github.com/jaypipes/kube-inspect/helm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+// writeKeyring generates a PGP key for the supplied identity and writes the
+// secret and public keyrings into the supplied directory. Returns the paths to
+// the secret and public keyrings.
+func writeKeyring(
+	t *testing.T,
+	dir string,
+	name string,
+	email string,
+) (string, string) {
+	require := require.New(t)
+	entity, err := openpgp.NewEntity(name, "", email, nil)
+	require.Nil(err)
+
+	secring := filepath.Join(dir, name+".secring.gpg")
+	f, err := os.Create(secring)
+	require.Nil(err)
+	require.Nil(entity.SerializePrivate(f, nil))
+	require.Nil(f.Close())
+
+	pubring := filepath.Join(dir, name+".pubring.gpg")
+	f, err = os.Create(pubring)
+	require.Nil(err)
+	require.Nil(entity.Serialize(f))
+	require.Nil(f.Close())
+	return secring, pubring
+}
+
+// signArchive writes a provenance file for the Helm Chart archive at the
+// supplied path, signed with the key in the supplied secret keyring.
+func signArchive(t *testing.T, secring string, path string) {
+	require := require.New(t)
+	signer, err := provenance.NewFromKeyring(secring, "")
+	require.Nil(err)
+	sig, err := signer.ClearSign(path)
+	require.Nil(err)
+	require.Nil(os.WriteFile(path+".prov", []byte(sig), 0o644))
+}
+
+func TestInspectWithKeyring(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	keyDir := t.TempDir()
+	secring, pubring := writeKeyring(t, keyDir, "signer", "signer@example.com")
+	_, otherPubring := writeKeyring(t, keyDir, "other", "other@example.com")
+
+	repoDir := writeHelmRepository(t, "0.1.0", "0.2.0")
+	signedPath := filepath.Join(repoDir, "child-0.1.0.tgz")
+	signArchive(t, secring, signedPath)
+	srv := httptest.NewServer(http.FileServer(http.Dir(repoDir)))
+	defer srv.Close()
+
+	subjects := map[string]string{
+		"local": signedPath,
+		"http":  srv.URL + "/child-0.1.0.tgz",
+	}
+	for name, subject := range subjects {
+		t.Run(name, func(t *testing.T) {
+			c, err := kihelm.Inspect(ctx, subject, kihelm.WithKeyring(pubring))
+			require.Nil(err)
+			v := c.Verification()
+			require.NotNil(v)
+			assert.Equal([]string{"signer <signer@example.com>"}, v.SignedBy)
+			assert.Len(v.KeyFingerprint, 40)
+			assert.Equal("child-0.1.0.tgz", v.FileName)
+			assert.Contains(v.FileHash, "sha256:")
+			assert.Empty(v.Digest)
+
+			// Signed by a key that is not in the keyring
+			_, err = kihelm.Inspect(
+				ctx, subject, kihelm.WithKeyring(otherPubring),
+			)
+			require.NotNil(err)
+		})
+	}
+
+	// Inspecting without a keyring does not verify
+	c, err := kihelm.Inspect(ctx, signedPath)
+	require.Nil(err)
+	assert.Nil(c.Verification())
+
+	// Missing provenance file
+	_, err = kihelm.Inspect(
+		ctx, filepath.Join(repoDir, "child-0.2.0.tgz"),
+		kihelm.WithKeyring(pubring),
+	)
+	require.NotNil(err)
+	assert.ErrorContains(err, "provenance file")
+
+	// Unpacked chart directories cannot be verified
+	_, err = kihelm.Inspect(
+		ctx, umbrellaLocalChartDir, kihelm.WithKeyring(pubring),
+	)
+	require.NotNil(err)
+
+	// Helm repository ChartLocations are verified
+	loc, err := kihelm.ChartLocationFromURL(srv.URL + "/child")
+	require.Nil(err)
+	c, err = kihelm.InspectLocation(
+		ctx, loc, "0.1.0", kihelm.WithKeyring(pubring),
+	)
+	require.Nil(err)
+	require.NotNil(c.Verification())
+	assert.Equal("child-0.1.0.tgz", c.Verification().FileName)
+}
+
+func TestInspectWithKeyringTamperedArchive(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+	keyDir := t.TempDir()
+	secring, pubring := writeKeyring(t, keyDir, "signer", "signer@example.com")
+
+	repoDir := writeHelmRepository(t, "0.1.0", "0.2.0")
+	signedPath := filepath.Join(repoDir, "child-0.1.0.tgz")
+	signArchive(t, secring, signedPath)
+
+	// Replace the signed archive with a different archive
+	other, err := os.ReadFile(filepath.Join(repoDir, "child-0.2.0.tgz"))
+	require.Nil(err)
+	require.Nil(os.WriteFile(signedPath, other, 0o644))
+
+	_, err = kihelm.Inspect(ctx, signedPath, kihelm.WithKeyring(pubring))
+	require.NotNil(err)
+}
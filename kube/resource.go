@@ -8,7 +8,6 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"strings"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -116,7 +115,7 @@ func DiffResources(
 
 	for bKind, bNameResources := range bResGroups {
 		if _, ok := aResGroups[bKind]; !ok {
-			removals = append(removals, lo.Values(bNameResources)...)
+			additions = append(additions, lo.Values(bNameResources)...)
 			continue
 		}
 		for bName, bRes := range bNameResources {
@@ -135,9 +134,7 @@ func DiffResources(
 }
 
 // resourcesByGroupVersionKindAndName returns a map, keyed by Resource Kind prefixed
-// with group version, of maps, keyed by Resource Name, of Kubernetes Resources. The
-// resource name will be stripped of the "kube-inspect-" prefix that we tack on while
-// templating the Helm release.
+// with group version, of maps, keyed by Resource Name, of Kubernetes Resources.
 func resourcesByGroupVersionKindAndName(
 	rs []*unstructured.Unstructured,
 ) kindNameResourceMap {
@@ -147,9 +144,6 @@ func resourcesByGroupVersionKindAndName(
 		if _, ok := res[groupVersionKind]; !ok {
 			res[groupVersionKind] = map[string]*unstructured.Unstructured{}
 		}
-		if after, ok := strings.CutPrefix(r.GetName(), "kube-inspect-"); ok {
-			r.SetName(after)
-		}
 		res[groupVersionKind][r.GetName()] = r
 	}
 	return res
@@ -90,3 +90,42 @@ func TestResourcesFromManifest_EmptyDocument(t *testing.T) {
 	assert.Len(resources, 1)
 	assert.Contains(resourceKinds, "Deployment")
 }
+
+func TestDiffResources_KindOnlyInOneSet(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+	ctx := context.TODO()
+	contents, err := os.ReadFile(singleDeploymentManifest)
+	require.Nil(err)
+	deployments, err := kube.ResourcesFromManifest(ctx, bytes.NewBuffer(contents))
+	require.Nil(err)
+	withConfigMap, err := kube.ResourcesFromManifest(
+		ctx, bytes.NewBufferString(string(contents)+`
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: extra
+data:
+  foo: bar
+`),
+	)
+	require.Nil(err)
+	require.Len(withConfigMap, 2)
+
+	// A Kind that only appears in the second set is an addition.
+	rd, err := kube.DiffResources(deployments, withConfigMap)
+	require.Nil(err)
+	require.Len(rd.Added, 1)
+	assert.Equal("ConfigMap", rd.Added[0].GetKind())
+	assert.Equal("extra", rd.Added[0].GetName())
+	assert.Empty(rd.Removed)
+	assert.Len(rd.Unchanged, 1)
+
+	// A Kind that only appears in the first set is a removal.
+	rd, err = kube.DiffResources(withConfigMap, deployments)
+	require.Nil(err)
+	require.Len(rd.Removed, 1)
+	assert.Equal("ConfigMap", rd.Removed[0].GetKind())
+	assert.Empty(rd.Added)
+}